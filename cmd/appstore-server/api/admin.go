@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/identity"
+)
+
+// Only let members of one of the admin groups through.
+func adminCtx(adminGroups []string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, found := identity.FromContext(r.Context())
+			if !found {
+				returnJSON(w, r, nil, identity.ErrUnauthenticated, http.StatusUnauthorized)
+				return
+			}
+			for _, g := range adminGroups {
+				if user.MemberOf(g) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			returnJSON(w, r, nil, fmt.Errorf("only administrators may use this endpoint"), http.StatusForbidden)
+		})
+	}
+}
+
+// Show which version of the namespace mapping is in use, and whether
+// the last reload failed.
+func makeNamespaceMappingVersionHandler(namespaceMappings config.MappingSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		returnJSON(w, r, namespaceMappings.Version(), nil, http.StatusOK)
+	}
+}
+
+func createAdminRouter(namespaceMappings config.MappingSource) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/namespace-mapping", makeNamespaceMappingVersionHandler(namespaceMappings))
+	return r
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/UNINETT/appstore/pkg/audit"
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/metrics"
+	"github.com/UNINETT/appstore/pkg/redact"
+)
+
+const defaultAuditLimit = 100
+
+// Make the audit sink available to the handlers.
+func auditCtx(sink audit.Sink) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), "audit.sink", sink))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Record the event of a request, along with who made it and how it
+// went. Events are only recorded for requests that passed through
+// auditCtx, while installs and deletes are always counted in the metrics.
+func recordAudit(context context.Context, event *audit.Event, status int, err error, logger *logrus.Entry) {
+	event.Time = time.Now().UTC()
+	event.RequestID = middleware.GetReqID(context)
+	if user, found := identity.FromContext(context); found {
+		event.User = user.UserId
+	}
+	event.Finish(status, err)
+	if event.Action == audit.ActionInstall || event.Action == audit.ActionDelete {
+		metrics.CountRelease(event.Action, event.Package, event.Outcome)
+	}
+
+	sink, found := context.Value("audit.sink").(audit.Sink)
+	if !found || sink == nil {
+		return
+	}
+
+	if err := sink.Record(event); err != nil {
+		logger.Errorf("Could not record the audit event of %s %s: %s", event.Action, event.Release, err.Error())
+	}
+}
+
+// The changes to the values of a release, with the secrets masked.
+func valuesDiff(redactor *redact.Redactor, old map[string]interface{}, new map[string]interface{}) []audit.Change {
+	return audit.Diff(chartValues(old), chartValues(new), func(path []string) (string, bool) {
+		return redact.Mask, redactor.Sensitive(path)
+	})
+}
+
+func parseAuditFilter(query url.Values) (*audit.Filter, error) {
+	f := &audit.Filter{
+		User:      query.Get("user"),
+		Action:    query.Get("action"),
+		Namespace: query.Get("namespace"),
+		Release:   query.Get("release"),
+		Outcome:   query.Get("outcome"),
+		Limit:     defaultAuditLimit,
+	}
+	for param, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s, expected a RFC 3339 time", param)
+			}
+			*t = parsed
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit")
+		}
+		f.Limit = limit
+	}
+
+	return f, nil
+}
+
+// List the audit events matching the filters in the query, the newest
+// first.
+func auditHandler(sink audit.Sink, query url.Values, logger *logrus.Entry) (int, interface{}, error) {
+	f, err := parseAuditFilter(query)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	events, err := sink.Query(f)
+	if err != nil {
+		logger.Errorf("Could not query the audit log: %s", err.Error())
+		return http.StatusInternalServerError, nil, fmt.Errorf("could not query the audit log")
+	}
+
+	return http.StatusOK, events, nil
+}
+
+func makeAuditHandler(sink audit.Sink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiReqLogger := logger.MakeAPILogger(r)
+		status, res, err := auditHandler(sink, r.URL.Query(), apiReqLogger)
+
+		returnJSON(w, r, res, err, status)
+	}
+}
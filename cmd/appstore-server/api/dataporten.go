@@ -7,6 +7,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 
+	"github.com/UNINETT/appstore/pkg/audit"
 	"github.com/UNINETT/appstore/pkg/dataporten"
 	"github.com/UNINETT/appstore/pkg/releaseutil"
 
@@ -17,7 +18,13 @@ const (
 	dataportenAppstoreSettingsKey = "dataporten_appstore_settings"
 )
 
-func deleteClientHandler(context context.Context, vals map[string]interface{}, logger *logrus.Entry) (int, interface{}, error) {
+// Delete the Dataporten client of the release with the values vals.
+// Without a Dataporten client, clients are never created and there is
+// nothing to delete.
+func deleteClientHandler(context context.Context, dp *dataporten.Client, vals map[string]interface{}, logger *logrus.Entry) (int, interface{}, error) {
+	if dp == nil {
+		return http.StatusOK, nil, nil
+	}
 	token := context.Value("token").(string)
 	if token == "" {
 		logger.Debug("No X-Dataporten-Token header not present")
@@ -32,27 +39,40 @@ func deleteClientHandler(context context.Context, vals map[string]interface{}, l
 	switch dpDetailsRaw.(type) {
 	case map[string]interface{}:
 		dpDetails := dpDetailsRaw.(map[string]interface{})
-		clientId = dpDetails["id"].(string)
+		clientId, _ = dpDetails["id"].(string)
 	case *dataporten.RegisterClientResult:
 		dpDetails := dpDetailsRaw.(*dataporten.RegisterClientResult)
 		clientId = dpDetails.ClientId
 	}
+	if clientId == "" {
+		return http.StatusInternalServerError, nil, fmt.Errorf("Dataporten client id not found")
+	}
 
 	logger.Debugf("Attempting to delete dataporten client: %s", clientId)
-	httpResp, err := dataporten.DeleteClient(clientId, token, logger)
+	err := dp.DeleteClient(context, clientId, token, logger)
+	event := &audit.Event{Action: audit.ActionDeleteClient, Client: clientId}
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
-	}
-	if httpResp.StatusCode != http.StatusOK {
-		return httpResp.StatusCode, nil, fmt.Errorf(httpResp.Status)
+		recordAudit(context, event, dataporten.HTTPStatus(err), err, logger)
+		return dataporten.HTTPStatus(err), nil, err
 	}
+	recordAudit(context, event, http.StatusOK, nil, logger)
 
 	logger.Debugf("Sucessfully deleted dataporten client: %s", clientId)
 	return http.StatusOK, nil, nil
 
 }
 
-func createClientHandler(context context.Context, rs *releaseutil.ReleaseSettings, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, *dataporten.RegisterClientResult, error) {
+// Register the Dataporten client asked for by the values of the release.
+// Without a Dataporten client, as when users are identified by an OIDC
+// provider, no client is created, and releases asking for one are
+// rejected.
+func createClientHandler(context context.Context, dp *dataporten.Client, rs *releaseutil.ReleaseSettings, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, *dataporten.RegisterClientResult, error) {
+	if dp == nil {
+		if s, _ := dataporten.MaybeGetSettings(rs.Values); s != nil {
+			return http.StatusBadRequest, nil, fmt.Errorf("Dataporten clients can't be created with this identity provider")
+		}
+		return http.StatusOK, nil, nil
+	}
 	token := context.Value("token").(string)
 	if token == "" {
 		logger.Debug("No X-Dataporten-Token header not present")
@@ -68,16 +88,14 @@ func createClientHandler(context context.Context, rs *releaseutil.ReleaseSetting
 	}
 
 	logger.Debugf("Attempting to register dataporten application %s", dataportenSettings.Name)
-	regResp, err := dataporten.CreateClient(dataportenSettings, token, logger)
-
-	if regResp.StatusCode != http.StatusCreated {
-		return regResp.StatusCode, nil, fmt.Errorf(regResp.Status)
-	}
-
-	dataportenRes, err := dataporten.ParseRegistrationResult(regResp.Body, logger)
+	dataportenRes, err := dp.CreateClient(context, dataportenSettings, token, logger)
+	event := &audit.Event{Action: audit.ActionCreateClient, Namespace: rs.Namespace, Package: rs.Package}
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
+		recordAudit(context, event, dataporten.HTTPStatus(err), err, logger)
+		return dataporten.HTTPStatus(err), nil, err
 	}
+	event.Client = dataportenRes.ClientId
+	recordAudit(context, event, http.StatusOK, nil, logger)
 
 	logger.Debugf("Successfully registered application %s", dataportenSettings.Name)
 	return http.StatusOK, dataportenRes, nil
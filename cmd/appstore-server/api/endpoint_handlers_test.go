@@ -1,16 +1,36 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/go-chi/chi"
 
 	"github.com/UNINETT/appstore/cmd/appstore-server/handlerutil"
+	"github.com/UNINETT/appstore/pkg/audit"
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/demo"
 	"github.com/UNINETT/appstore/pkg/helmutil"
+	"github.com/UNINETT/appstore/pkg/hostnames"
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/install"
+	"github.com/UNINETT/appstore/pkg/quota"
+	"github.com/UNINETT/appstore/pkg/redact"
+	"github.com/UNINETT/appstore/pkg/releaseutil"
 
 	"k8s.io/helm/cmd/helm/search"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/helm"
+	helm_env "k8s.io/helm/pkg/helm/environment"
 )
 
 func TestPackageIndexHandler(t *testing.T) {
@@ -35,3 +55,279 @@ func TestPackageSearchHandler(t *testing.T) {
 		t.Errorf("decoding of result failed: %s", err.Error())
 	}
 }
+
+var testLogger = logrus.NewEntry(logrus.StandardLogger())
+
+var testUsers = []*dataporten.FakeUser{
+	{UserId: "user-1", Name: "Test User", Token: "test-token", Groups: []string{"fc:org:uninett.no"}},
+}
+
+const testNamespaceMapping = `
+- id: researchlab
+  subjects:
+    - fc:orgunit:systemavdelingen
+- id: uninett-experimental
+  subjects:
+    - fc:org:uninett.no
+  roles:
+    admin:
+      - fc:org:*
+      - "!fc:org:example.org"
+`
+
+func tokenContext(token string) context.Context {
+	return context.WithValue(context.Background(), "token", token)
+}
+
+func TestCreateClientHandler(t *testing.T) {
+	fake, ts, dp := dataporten.NewTestServer(testUsers)
+	defer ts.Close()
+
+	rs := &releaseutil.ReleaseSettings{Values: map[string]interface{}{
+		"secrets": map[string]interface{}{
+			"dataporten": map[string]interface{}{
+				"name":             "test-client",
+				"scopes_requested": []interface{}{"profile"},
+				"redirect_uri":     []interface{}{"https://example.org/callback"},
+			},
+		},
+	}}
+
+	status, res, err := createClientHandler(tokenContext("test-token"), dp, rs, helmutil.MockSettings, testLogger)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("client registration failed: %d, %v", status, err)
+	}
+	if res.Owner != "user-1" {
+		t.Errorf("client has unexpected owner: got %s want user-1", res.Owner)
+	}
+	if _, found := fake.RegisteredClient(res.ClientId); !found {
+		t.Errorf("client %s was not registered", res.ClientId)
+	}
+
+	status, _, _ = createClientHandler(tokenContext("invalid-token"), dp, rs, helmutil.MockSettings, testLogger)
+	if status != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %d want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestListNamespacesHandler(t *testing.T) {
+	_, ts, dp := dataporten.NewTestServer(testUsers)
+	defer ts.Close()
+
+	f, err := ioutil.TempFile("", "subjects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testNamespaceMapping)
+	f.Close()
+	namespaceMappings, err := config.NewNamespaceMappingStore(f.Name(), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := identity.NewDataportenProvider(dataporten.NewGroupCache(dp, time.Minute, 10))
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Dataporten-Token", "test-token")
+	user, err := provider.Identify(r, testLogger)
+	if err != nil {
+		t.Fatalf("identifying the user failed: %s", err.Error())
+	}
+
+	status, res, err := listNamespacesHandler(identity.NewContext(tokenContext("test-token"), user), namespaceMappings, helmutil.MockSettings, testLogger)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("listing namespaces failed: %d, %v", status, err)
+	}
+	namespaces := res.([]*Namespace)
+	if len(namespaces) != 1 || namespaces[0].NamespaceId != "uninett-experimental" {
+		t.Fatalf("handler returned unexpected namespaces: %v", namespaces)
+	}
+	if namespaces[0].Role != config.RoleAdmin || namespaces[0].GrantedBy != "fc:org:*" {
+		t.Errorf("user has unexpected role: got %s granted by %s", namespaces[0].Role, namespaces[0].GrantedBy)
+	}
+}
+
+func TestUpgradeValues(t *testing.T) {
+	mapping := &config.NamespaceMapping{
+		DefaultValues:  map[string]interface{}{"image": "default", "debug": true},
+		EnforcedValues: map[string]interface{}{"replicas": 1, "release": "tmpl:{{ .Release.Name }}"},
+	}
+	stored := map[string]interface{}{"image": "custom", "replicas": 3, "escaped": "tmpl:abc"}
+	md := &PackageAppstoreMetaData{Repo: "stable"}
+	ctx := &install.TemplateContext{Release: install.TemplateRelease{Name: "jupyter-abc123"}}
+
+	values, err := upgradeValues(stored, md, mapping, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"image":             "custom",
+		"debug":             true,
+		"replicas":          1,
+		"escaped":           "tmpl:abc",
+		"release":           "jupyter-abc123",
+		appstoreMetaDataKey: PackageAppstoreMetaData{Repo: "stable", Defaults: map[string]interface{}{"image": "default", "debug": true}},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: got %v want %v", values, expected)
+	}
+	if stored["replicas"] != 3 || mapping.EnforcedValues["release"] != "tmpl:{{ .Release.Name }}" || md.Defaults != nil {
+		t.Error("the stored or enforced values were modified")
+	}
+}
+
+func TestUpgradeValuesChangedDefaults(t *testing.T) {
+	ctx := &install.TemplateContext{Release: install.TemplateRelease{Name: "jupyter-abc123"}}
+	mapping := &config.NamespaceMapping{
+		DefaultValues: map[string]interface{}{
+			"image":   "jupyter:1",
+			"ingress": map[string]interface{}{"class": "nginx"},
+		},
+	}
+	installed, defaults, err := namespaceValues(map[string]interface{}{"replicas": 2}, mapping, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &PackageAppstoreMetaData{Repo: "stable", Defaults: defaults}
+
+	// The default image changes, and the ingress class is no longer set.
+	mapping.DefaultValues = map[string]interface{}{"image": "jupyter:2", "storage": "tmpl:{{ .Release.Name }}-data"}
+	values, err := upgradeValues(installed, md, mapping, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(values, appstoreMetaDataKey)
+	expected := map[string]interface{}{"image": "jupyter:2", "replicas": 2, "storage": "jupyter-abc123-data"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("the changed defaults did not reach the release: got %v want %v", values, expected)
+	}
+
+	// Values the user gave are kept, even where a default changed.
+	installed["image"] = "custom"
+	values, err = upgradeValues(installed, md, mapping, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["image"] != "custom" {
+		t.Errorf("the user's value was replaced by a default: %v", values["image"])
+	}
+}
+
+// Settings using the in-memory Tiller of the demo mode, with the demo
+// charts in the stable repository. The returned function removes the
+// helm home.
+func demoSettings(t *testing.T) (*helm_env.EnvSettings, func()) {
+	home, err := demo.SetupHelmHome("../../../demo/charts", testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := demo.NewTiller(testLogger).Serve()
+	if err != nil {
+		os.RemoveAll(home.String())
+		t.Fatal(err)
+	}
+	settings := helmutil.InitHelmSettings(false, addr)
+	settings.Home = home
+
+	return settings, func() { os.RemoveAll(home.String()) }
+}
+
+func testMappings(t *testing.T) config.MappingSource {
+	f, err := ioutil.TempFile("", "subjects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(testNamespaceMapping)
+	f.Close()
+	namespaceMappings, err := config.NewNamespaceMappingStore(f.Name(), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return namespaceMappings
+}
+
+// The context of a request by user-1, identified without a Dataporten
+// token as by an OIDC provider.
+func userContext() context.Context {
+	user := &identity.Identity{UserId: "user-1", Name: "Test User", Groups: []string{"fc:org:uninett.no"}}
+	return identity.NewContext(tokenContext(""), user)
+}
+
+func TestInstallReleaseWithoutDataporten(t *testing.T) {
+	settings, cleanup := demoSettings(t)
+	defer cleanup()
+	namespaceMappings := testMappings(t)
+
+	ctx := userContext()
+	installNginx := func(values string) (int, interface{}, error) {
+		body := ioutil.NopCloser(strings.NewReader(`{"package": "nginx", "namespace": "uninett-experimental", "values": ` + values + `}`))
+		return installReleaseHandler(ctx, &audit.Event{}, nil, redact.NewRedactor(redact.DefaultPaths), nil, nil, hostnames.NewAllocator(), quota.NewLocks(), body, namespaceMappings, settings, testLogger)
+	}
+
+	status, res, err := installNginx(`{"replicas": 2}`)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("install failed: %d, %v", status, err)
+	}
+	rel := res.(releaseutil.Release)
+	if _, found := rel.Values[dataportenAppstoreSettingsKey]; found {
+		t.Errorf("a Dataporten client was created: %v", rel.Values[dataportenAppstoreSettingsKey])
+	}
+
+	status, _, _ = installNginx(`{"secrets": {"dataporten": {"name": "nginx", "scopes_requested": ["profile"], "redirect_uri": ["https://example.org"]}}}`)
+	if status != http.StatusBadRequest {
+		t.Errorf("a release needing a Dataporten client was installed: %d", status)
+	}
+}
+
+func TestReleaseStatusHandler(t *testing.T) {
+	settings, cleanup := demoSettings(t)
+	defer cleanup()
+	namespaceMappings := testMappings(t)
+	client := helmutil.InitHelmClient(context.Background(), settings)
+	ch, err := chartutil.Load("../../../demo/charts/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, namespace := range map[string]string{"nginx-visible": "uninett-experimental", "nginx-hidden": "researchlab"} {
+		if _, err := client.InstallReleaseFromChart(ch, namespace, helm.ReleaseName(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, _, err := releaseStatusHandler(userContext(), "nginx-visible", namespaceMappings, settings, testLogger)
+	if status != http.StatusOK {
+		t.Errorf("the status of a visible release was not returned: %d, %v", status, err)
+	}
+	// The user can't tell a release in another namespace from one which
+	// doesn't exist.
+	for _, name := range []string{"nginx-hidden", "nginx-missing"} {
+		status, _, err := releaseStatusHandler(userContext(), name, namespaceMappings, settings, testLogger)
+		if status != http.StatusNotFound || err == nil || err.Error() != "release "+name+" not found" {
+			t.Errorf("%s: expected not found, got %d, %v", name, status, err)
+		}
+	}
+}
+
+func TestAssignHost(t *testing.T) {
+	mapping := &config.NamespaceMapping{NamespaceId: "researchlab", Domain: "lab.example.org", HostPaths: []string{"ingress.hosts[]"}}
+
+	values := map[string]interface{}{}
+	if _, err := assignHost(mapping, "nginx-abc123", values, nil, true, testLogger); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := hostnames.FromValues(values, mapping.HostPaths); len(hosts) != 1 || hosts[0] != "nginx-abc123.lab.example.org" {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+
+	outside := map[string]interface{}{"ingress": map[string]interface{}{"hosts": []interface{}{"Nginx.Example.org"}}}
+	if status, err := assignHost(mapping, "nginx-abc123", outside, nil, true, testLogger); status != http.StatusBadRequest || err == nil {
+		t.Errorf("a host outside the domain was accepted: %d", status)
+	}
+	// Releases keep the hosts they have when upgraded.
+	previous := map[string]interface{}{"ingress": map[string]interface{}{"hosts": []interface{}{"nginx.example.org"}}}
+	if _, err := assignHost(mapping, "nginx-abc123", outside, previous, false, testLogger); err != nil {
+		t.Errorf("the host of an upgraded release was rejected: %s", err.Error())
+	}
+}
@@ -4,17 +4,39 @@ import (
 	"net/http"
 
 	"github.com/go-chi/render"
+
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/policy"
+	"github.com/UNINETT/appstore/pkg/quota"
+	"github.com/UNINETT/appstore/pkg/schema"
 )
 
 type ErrorJson struct {
 	Error string `json:"error"`
+	// The invalid values, when the values of a release are rejected.
+	Fields []schema.FieldError `json:"fields,omitempty"`
+	// The objects breaking the policy, when a release is rejected.
+	Violations []policy.Violation `json:"violations,omitempty"`
+	// The usage of the namespace, when its quota is exceeded.
+	Usage *quota.Usage `json:"usage,omitempty"`
 }
 
 func returnJSON(w http.ResponseWriter, r *http.Request, res interface{}, err error, status int) {
 	render.Status(r, status)
-	if err != nil {
-		render.JSON(w, r, ErrorJson{err.Error()})
-	} else {
+	switch e := err.(type) {
+	case nil:
 		render.JSON(w, r, res)
+	case *schema.ValidationError:
+		render.JSON(w, r, ErrorJson{Error: e.Error(), Fields: e.Errors})
+	case *policy.ViolationError:
+		render.JSON(w, r, ErrorJson{Error: e.Error(), Violations: e.Violations})
+	case *quota.ExceededError:
+		usage := e.Usage
+		if user, found := identity.FromContext(r.Context()); found && usage != nil {
+			usage = ownUsage(usage, user.UserId)
+		}
+		render.JSON(w, r, ErrorJson{Error: e.Error(), Usage: usage})
+	default:
+		render.JSON(w, r, ErrorJson{Error: e.Error()})
 	}
 }
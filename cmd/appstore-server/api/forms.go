@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
+
+	"github.com/UNINETT/appstore/pkg/form"
+	"github.com/UNINETT/appstore/pkg/install"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/schema"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// Describe the values of a package as an install form. The form is
+// derived from the schema of the values when the chart has one, and is
+// otherwise inferred from the default values of the chart.
+func packageFormHandler(ctx context.Context, schemas *schema.Registry, packageName, repo, version string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+	status, chartPath, chartRequested, err := loadChart(ctx, packageName, repo, version, settings, logger)
+	if err != nil {
+		return status, nil, err
+	}
+
+	var f *form.Form
+	valuesSchema, found, err := valuesSchema(schemas, chartRequested)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if found {
+		var defaults map[string]interface{}
+		defaults, err = install.GetAllVals(chartRequested.GetValues().GetRaw(), logger)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		f, err = form.FromSchema(valuesSchema, defaults)
+	} else {
+		f, err = form.FromValues(chartRequested.GetValues().GetRaw())
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	annotations, err := form.ChartAnnotations(chartPath)
+	if err != nil {
+		logger.Warnf("Could not read the annotations of %s: %s", packageName, err.Error())
+	}
+	if annotation, found := annotations[form.Annotation]; found {
+		overrides, err := form.ParseOverrides(annotation)
+		if err != nil {
+			logger.Warnf("Ignoring the invalid form annotation of %s: %s", packageName, err.Error())
+		}
+		f.Apply(overrides)
+	}
+
+	metadata := chartRequested.GetMetadata()
+	f.Package = metadata.GetName()
+	f.Version = metadata.GetVersion()
+
+	return http.StatusOK, f, nil
+}
+
+func makePackageFormHandler(settings *helm_env.EnvSettings, schemas *schema.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiReqLogger := logger.MakeAPILogger(r)
+
+		p := chi.URLParam(r, "packageName")
+		v := r.URL.Query().Get("version")
+		repo := r.URL.Query().Get("repo")
+
+		status, res, err := packageFormHandler(r.Context(), schemas, p, repo, v, settings, apiReqLogger)
+
+		returnJSON(w, r, res, err, status)
+	}
+}
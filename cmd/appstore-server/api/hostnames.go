@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/hostnames"
+	"github.com/UNINETT/appstore/pkg/install"
+	"github.com/UNINETT/appstore/pkg/status"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// The ingress hosts of the existing releases, from their manifests and
+// values, mapped to the name of the release using them. The values are
+// read at the host paths of the namespace of each release.
+func usedHosts(ctx context.Context, mappings []*config.NamespaceMapping, settings *helm_env.EnvSettings, logger *logrus.Entry) (map[string]string, error) {
+	releases, err := status.GetAllReleases(ctx, settings, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]string)
+	for _, rel := range releases {
+		for _, host := range hostnames.FromManifest(rel.GetManifest()) {
+			used[host] = rel.Name
+		}
+		values, err := install.GetAllVals(rel.GetConfig().GetRaw(), logger)
+		if err != nil {
+			continue
+		}
+		paths := config.FindNamespace(mappings, rel.Namespace).HostValuePaths()
+		for _, host := range hostnames.FromValues(values, paths) {
+			used[hostnames.Normalize(host)] = rel.Name
+		}
+	}
+
+	return used, nil
+}
+
+// Give a release without a host one under the domain of the namespace,
+// if it has one and generate is set, so that the values can be validated
+// with the host they are installed with. Hosts are only generated on
+// install, an upgraded release keeps the hosts it has, if any. Hosts
+// outside the domain are rejected, except those in the previous values
+// of an upgraded release.
+func assignHost(mapping *config.NamespaceMapping, releaseName string, values map[string]interface{}, previous map[string]interface{}, generate bool, logger *logrus.Entry) (int, error) {
+	paths := mapping.HostValuePaths()
+	hosts := hostnames.FromValues(values, paths)
+	if len(hosts) == 0 {
+		if !generate || mapping == nil || mapping.Domain == "" {
+			return http.StatusOK, nil
+		}
+		host := hostnames.Generate(releaseName, mapping.Domain)
+		hostnames.SetInValues(values, paths, host)
+		logger.Debugf("Allocated the host %s to %s", host, releaseName)
+		return http.StatusOK, nil
+	}
+
+	hostnames.NormalizeValues(values, paths)
+	if mapping == nil || mapping.Domain == "" {
+		return http.StatusOK, nil
+	}
+	kept := make(map[string]bool)
+	for _, host := range hostnames.FromValues(previous, paths) {
+		kept[hostnames.Normalize(host)] = true
+	}
+	for _, host := range hostnames.FromValues(values, paths) {
+		if !kept[host] && !hostnames.InDomain(host, mapping.Domain) {
+			return http.StatusBadRequest, fmt.Errorf("the host %s is not under the domain %s of the namespace", host, mapping.Domain)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// Make sure the hosts of the release, if it has any, are used by no
+// other release. The returned function releases the reservations of the
+// hosts, and must be called once the release is installed or upgraded.
+func allocateHost(ctx context.Context, hosts *hostnames.Allocator, mapping *config.NamespaceMapping, namespaceMappings config.MappingSource, releaseName string, values map[string]interface{}, settings *helm_env.EnvSettings, logger *logrus.Entry) (func(), int, error) {
+	requested := hostnames.FromValues(values, mapping.HostValuePaths())
+	if len(requested) == 0 {
+		return func() {}, http.StatusOK, nil
+	}
+
+	used, err := usedHosts(ctx, namespaceMappings.Mappings(), settings, logger)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	var reserved []func()
+	releaseAll := func() {
+		for _, done := range reserved {
+			done()
+		}
+	}
+	for _, host := range requested {
+		done, err := hosts.Reserve(host, releaseName, used)
+		if err != nil {
+			releaseAll()
+			if _, conflict := err.(*hostnames.ConflictError); conflict {
+				return nil, http.StatusConflict, err
+			}
+			return nil, http.StatusBadRequest, err
+		}
+		reserved = append(reserved, done)
+	}
+
+	return releaseAll, http.StatusOK, nil
+}
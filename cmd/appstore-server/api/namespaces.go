@@ -6,63 +6,79 @@ import (
 	"net/http"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
 
 	"github.com/UNINETT/appstore/pkg/config"
-	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/identity"
 	"github.com/UNINETT/appstore/pkg/logger"
 	helm_env "k8s.io/helm/pkg/helm/environment"
 )
 
-const (
-	namespaceMappingFile = "subjects.yml"
-)
+// A namespace along with the role the user has in it, and the subject
+// in the mapping which granted the role.
+type Namespace struct {
+	*config.NamespaceMapping
+	Role      config.Role `json:"role"`
+	GrantedBy string      `json:"granted_by"`
+}
 
-// Return a list of the namespaces the enduser is allowed to deploy to.
-// The namespaceMappingFile contains a hardcoded mapping between
-// namespaces and subjects (which in this case may be dataporten
-// groups), and this mapping is used to determine which namespace the
-// user is allowed to use.
-func listNamespacesHandler(context context.Context, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
-	token := context.Value("token").(string)
-	if token == "" {
-		logger.Debug("No X-Dataporten-Token header not present")
-		return http.StatusBadRequest, nil, fmt.Errorf("missing X-Dataporten-Token")
-	}
-	groupsResp, err := dataporten.RequestGroups(token, logger)
-	if err != nil {
-		return groupsResp.StatusCode, nil, err
+// Return a list of the namespaces the enduser has access to, and the
+// role the user has in each of them. The namespace mapping file
+// contains a hardcoded mapping between namespaces and subjects (which
+// in this case may be dataporten groups), and this mapping is used to
+// determine which namespace the user is allowed to use.
+func listNamespacesHandler(context context.Context, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+	user, found := identity.FromContext(context)
+	if !found {
+		return http.StatusUnauthorized, nil, identity.ErrUnauthenticated
 	}
-	if groupsResp.StatusCode != 200 {
-		return groupsResp.StatusCode, nil, fmt.Errorf(groupsResp.Status)
-	}
-	userGroups, err := dataporten.ParseGroupResult(groupsResp.Body, logger)
-	if err != nil {
-		return http.StatusInternalServerError, nil, err
+
+	groups := config.NewSubjectSet(user.Groups)
+	allowedNamespaces := make([]*Namespace, 0)
+	for _, n := range namespaceMappings.Mappings() {
+		if role, grantedBy := n.Grant(groups); role != config.RoleNone {
+			allowedNamespaces = append(allowedNamespaces, &Namespace{n, role, grantedBy})
+		}
 	}
 
-	namespaceSubjectMapping, err := config.LoadNamespaceMappings("./" + namespaceMappingFile)
-	if err != nil {
-		return http.StatusInternalServerError, nil, fmt.Errorf("could not load namespace to subject mapping")
+	return http.StatusOK, allowedNamespaces, nil
+}
+
+// Show a namespace the user has access to, including the default and
+// enforced values of its releases.
+func namespaceDetailHandler(context context.Context, namespaceId string, namespaceMappings config.MappingSource, logger *logrus.Entry) (int, interface{}, error) {
+	user, found := identity.FromContext(context)
+	if !found {
+		return http.StatusUnauthorized, nil, identity.ErrUnauthenticated
 	}
 
-	allowedNamespaces := make([]*config.NamespaceMapping, 0)
-	for _, n := range namespaceSubjectMapping {
-		for _, ag := range n.AllowedSubjects {
-			for _, ug := range userGroups {
-				if ag == ug.GroupId {
-					allowedNamespaces = append(allowedNamespaces, n)
-				}
-			}
-		}
+	mapping := config.FindNamespace(namespaceMappings.Mappings(), namespaceId)
+	if mapping == nil {
+		return http.StatusNotFound, nil, fmt.Errorf("namespace %s not found", namespaceId)
+	}
+	role, grantedBy := mapping.Grant(config.NewSubjectSet(user.Groups))
+	if role == config.RoleNone {
+		logger.Debugf("User %s has no access to namespace %s", user.UserId, namespaceId)
+		return http.StatusNotFound, nil, fmt.Errorf("namespace %s not found", namespaceId)
 	}
 
-	return http.StatusOK, allowedNamespaces, nil
+	return http.StatusOK, &Namespace{mapping, role, grantedBy}, nil
+}
+
+func makeNamespaceDetailHandler(namespaceMappings config.MappingSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiReqLogger := logger.MakeAPILogger(r)
+		namespaceId := chi.URLParam(r, "namespaceId")
+		status, res, err := namespaceDetailHandler(r.Context(), namespaceId, namespaceMappings, apiReqLogger)
+
+		returnJSON(w, r, res, err, status)
+	}
 }
 
-func makeListNamespacesHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeListNamespacesHandler(settings *helm_env.EnvSettings, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
-		status, res, err := listNamespacesHandler(r.Context(), settings, apiReqLogger)
+		status, res, err := listNamespacesHandler(r.Context(), namespaceMappings, settings, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
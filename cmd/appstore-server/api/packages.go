@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -14,13 +15,20 @@ import (
 	app_search "github.com/UNINETT/appstore/pkg/search"
 
 	"k8s.io/helm/cmd/helm/search"
-	"k8s.io/helm/pkg/chartutil"
 	helm_env "k8s.io/helm/pkg/helm/environment"
 	"k8s.io/helm/pkg/proto/hapi/chart"
 )
 
 type PackageAppstoreMetaData struct {
 	Repo string `json:"repo"`
+	// Id of the user who installed the release.
+	Owner string `json:"owner,omitempty"`
+	// The subject of the namespace mapping which gave the owner access,
+	// which the release counts against in the quota.
+	Group string `json:"group,omitempty"`
+	// The default values of the namespace applied to the release, to
+	// tell them apart from the user's when it is upgraded.
+	Defaults map[string]interface{} `json:"defaults,omitempty"`
 }
 
 const (
@@ -28,9 +36,17 @@ const (
 )
 
 // Show all information about a given package / chart
-func PackageDetailHandler(packageName, repo, version string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, *chart.Chart, error) {
+func PackageDetailHandler(ctx context.Context, packageName, repo, version string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, *chart.Chart, error) {
+	status, _, chartRequested, err := loadChart(ctx, packageName, repo, version, settings, logger)
+
+	return status, chartRequested, err
+}
+
+// Locate and load the given package, returning the path of the chart
+// along with the chart itself.
+func loadChart(ctx context.Context, packageName, repo, version string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, string, *chart.Chart, error) {
 	if packageName == "" {
-		return http.StatusBadRequest, nil, fmt.Errorf("no package specified")
+		return http.StatusBadRequest, "", nil, fmt.Errorf("no package specified")
 	}
 
 	if repo == "" {
@@ -38,17 +54,17 @@ func PackageDetailHandler(packageName, repo, version string, settings *helm_env.
 	}
 
 	// TODO: Handle TLS related things:
-	chartPath, err := install.LocateChartPath(packageName, repo, version, false, "", settings, logger)
+	chartPath, err := install.LocateChartPath(ctx, packageName, repo, version, false, "", settings, logger)
 	if err != nil {
-		return http.StatusNotFound, nil, fmt.Errorf("%s, version: %s, repo: %s not found", packageName, version, repo)
+		return http.StatusNotFound, "", nil, fmt.Errorf("%s, version: %s, repo: %s not found", packageName, version, repo)
 	}
 
-	chartRequested, err := chartutil.Load(chartPath)
+	chartRequested, err := install.LoadChart(ctx, chartPath)
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
+		return http.StatusInternalServerError, "", nil, err
 	}
 
-	return http.StatusOK, chartRequested, nil
+	return http.StatusOK, chartPath, chartRequested, nil
 }
 
 func makePackageDetailHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
@@ -59,7 +75,7 @@ func makePackageDetailHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
 		v := r.URL.Query().Get("version")
 		repo := r.URL.Query().Get("repo")
 
-		status, res, err := PackageDetailHandler(p, repo, v, settings, apiReqLogger)
+		status, res, err := PackageDetailHandler(r.Context(), p, repo, v, settings, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
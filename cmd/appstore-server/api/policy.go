@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/policy"
+	"github.com/UNINETT/appstore/pkg/quota"
+
+	"k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// The manifest of a release rendered by a dry run, along with the
+// manifests of its hooks. Tiller keeps the hooks apart, but they create
+// pods all the same.
+func renderedManifest(rel *release.Release) string {
+	manifests := []string{rel.GetManifest()}
+	for _, hook := range rel.GetHooks() {
+		manifests = append(manifests, hook.GetManifest())
+	}
+
+	return strings.Join(manifests, "\n---\n")
+}
+
+// Check the manifest of a release, as rendered by a dry run, against the
+// policy of its namespace.
+func checkPolicy(p *policy.Policy, namespace string, manifest string) (int, error) {
+	err := policy.Check(manifest, p.For(namespace))
+	if _, violated := err.(*policy.ViolationError); violated {
+		return http.StatusUnprocessableEntity, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// Whether releases in the namespace must be rendered by a dry run, and
+// checked with checkRendered, before they are installed or upgraded.
+func needsDryRun(p *policy.Policy, mapping *config.NamespaceMapping) bool {
+	return p != nil || (mapping != nil && mapping.Quota.LimitsResources())
+}
+
+// Check a release rendered by a dry run, including its hooks, against
+// the policy and the resource quota of its namespace, given what the
+// other releases in the namespace use.
+func checkRendered(p *policy.Policy, mapping *config.NamespaceMapping, usage *quota.Usage, namespace string, rel *release.Release) (int, error) {
+	manifest := renderedManifest(rel)
+	if p != nil {
+		if status, err := checkPolicy(p, namespace, manifest); err != nil {
+			return status, err
+		}
+	}
+
+	return checkResourceQuota(mapping, usage, manifest)
+}
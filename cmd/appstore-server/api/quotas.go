@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/install"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/quota"
+	"github.com/UNINETT/appstore/pkg/status"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// What the releases in namespace use, except the release named exclude.
+func namespaceUsage(ctx context.Context, namespace string, exclude string, settings *helm_env.EnvSettings, logger *logrus.Entry) (*quota.Usage, error) {
+	releases, err := status.GetAllReleases(ctx, settings, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var counted []quota.Release
+	for _, rel := range releases {
+		if rel.Namespace != namespace || rel.Name == exclude {
+			continue
+		}
+		r := quota.Release{}
+		values, err := install.GetAllVals(rel.GetConfig().GetRaw(), logger)
+		if err == nil {
+			if md, err := getPackageMetaData(values); err == nil {
+				r.Owner = md.Owner
+				r.Group = md.Group
+			}
+		}
+		r.Resources, err = quota.ManifestResources(rel.GetManifest())
+		if err != nil {
+			logger.Warnf("Could not count the resources of %s: %s", rel.Name, err.Error())
+		}
+		counted = append(counted, r)
+	}
+
+	return quota.NewUsage(counted), nil
+}
+
+// Too many releases is rejected with 429, as deleting a release lets the
+// user install another, and releases requesting too much with 403.
+func quotaStatus(err error) int {
+	if e, ok := err.(*quota.ExceededError); ok {
+		if e.Resources {
+			return http.StatusForbidden
+		}
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Lock the namespace for checking the quota, unless the request is
+// canceled or times out while waiting for another install.
+func lockNamespace(ctx context.Context, locks *quota.Locks, namespace string) (func(), int, error) {
+	unlock, err := locks.Lock(ctx, namespace)
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("waiting for another install in %s: %s", namespace, err.Error())
+	}
+
+	return unlock, http.StatusOK, nil
+}
+
+// Check that the owner, given access by group, may install another
+// release in the namespace. Returns the usage of the namespace, to
+// check the resources of the release against once it is rendered, or
+// nil if the namespace has no quota.
+func checkReleaseQuota(ctx context.Context, mapping *config.NamespaceMapping, owner string, group string, settings *helm_env.EnvSettings, logger *logrus.Entry) (*quota.Usage, int, error) {
+	if mapping == nil || mapping.Quota == nil {
+		return nil, http.StatusOK, nil
+	}
+	usage, err := namespaceUsage(ctx, mapping.NamespaceId, "", settings, logger)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := mapping.Quota.CheckReleases(usage, owner, group); err != nil {
+		return nil, quotaStatus(err), err
+	}
+
+	return usage, http.StatusOK, nil
+}
+
+// Check the resources requested by a release, as rendered by a dry run,
+// against the quota.
+func checkResourceQuota(mapping *config.NamespaceMapping, usage *quota.Usage, manifest string) (int, error) {
+	if mapping == nil || !mapping.Quota.LimitsResources() {
+		return http.StatusOK, nil
+	}
+	requested, err := quota.ManifestResources(manifest)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := mapping.Quota.CheckResources(usage, requested); err != nil {
+		return quotaStatus(err), err
+	}
+
+	return http.StatusOK, nil
+}
+
+// The usage as shown to a user, with only the number of releases of the
+// user rather than that of every user.
+func ownUsage(u *quota.Usage, userId string) *quota.Usage {
+	c := *u
+	c.Owners = map[string]int{userId: u.Owners[userId]}
+
+	return &c
+}
+
+type NamespaceUsage struct {
+	Namespace string       `json:"namespace"`
+	Quota     *quota.Quota `json:"quota"`
+	Usage     *quota.Usage `json:"usage"`
+}
+
+// Show the quota of a namespace the user has access to, and what its
+// releases use of it. Only admins of the namespace see how many releases
+// each user has, the others only their own.
+func namespaceUsageHandler(context context.Context, namespaceId string, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+	user, found := identity.FromContext(context)
+	if !found {
+		return http.StatusUnauthorized, nil, identity.ErrUnauthenticated
+	}
+
+	mapping := config.FindNamespace(namespaceMappings.Mappings(), namespaceId)
+	var role config.Role
+	if mapping != nil {
+		role = mapping.RoleOf(user.Groups)
+	}
+	if role == config.RoleNone {
+		return http.StatusNotFound, nil, fmt.Errorf("namespace %s not found", namespaceId)
+	}
+	usage, err := namespaceUsage(context, namespaceId, "", settings, logger)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if !role.Includes(config.RoleAdmin) {
+		usage = ownUsage(usage, user.UserId)
+	}
+
+	return http.StatusOK, &NamespaceUsage{Namespace: namespaceId, Quota: mapping.Quota, Usage: usage}, nil
+}
+
+func makeNamespaceUsageHandler(settings *helm_env.EnvSettings, namespaceMappings config.MappingSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiReqLogger := logger.MakeAPILogger(r)
+		namespaceId := chi.URLParam(r, "namespaceId")
+		status, res, err := namespaceUsageHandler(r.Context(), namespaceId, namespaceMappings, settings, apiReqLogger)
+
+		returnJSON(w, r, res, err, status)
+	}
+}
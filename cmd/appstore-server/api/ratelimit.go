@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/metrics"
+	"github.com/UNINETT/appstore/pkg/ratelimit"
+)
+
+// The client a request is counted against: the user when known, and
+// otherwise the address.
+func rateLimitKey(r *http.Request) string {
+	if id, found := identity.FromContext(r.Context()); found {
+		return "user:" + id.UserId
+	}
+
+	return addressKey(r)
+}
+
+// The address of the client, as set by middleware.RealIP.
+func addressKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// Reject the requests of clients that have used up their budget with
+// 429, counting the requests of each client given by key. Requests are
+// not limited when limiter is nil, nor when the store of the budgets
+// fails.
+func rateLimitCtx(limiter *ratelimit.Limiter, key func(r *http.Request) string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := limiter.Take(key(r), r.Method)
+			if err != nil {
+				logger.MakeAPILogger(r).Warnf("Could not check the rate limit: %s", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+			if res.Limit > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ratelimit.Seconds(res.Reset)))
+			}
+			if !res.Allowed {
+				budget := ratelimit.Budget(r.Method)
+				metrics.CountRateLimited(budget)
+				retryAfter := ratelimit.Seconds(res.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				returnJSON(w, r, nil, fmt.Errorf("too many %s requests, retry in %d seconds", budget, retryAfter), http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
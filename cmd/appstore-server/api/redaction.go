@@ -0,0 +1,60 @@
+package api
+
+import (
+	"github.com/ghodss/yaml"
+
+	"github.com/UNINETT/appstore/pkg/redact"
+
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// The file in a chart holding appstore specific settings of the chart.
+const chartAppstoreFile = "appstore.yaml"
+
+type chartAppstoreConfig struct {
+	// Paths of values that are secret, in addition to the default ones.
+	Sensitive []string `json:"sensitive"`
+}
+
+func chartConfig(ch *chart.Chart) *chartAppstoreConfig {
+	config := new(chartAppstoreConfig)
+	for _, f := range ch.GetFiles() {
+		if f.TypeUrl == chartAppstoreFile {
+			yaml.Unmarshal(f.Value, config)
+			break
+		}
+	}
+
+	return config
+}
+
+// A redactor also masking the paths the chart marks as sensitive.
+func chartRedactor(redactor *redact.Redactor, ch *chart.Chart) *redact.Redactor {
+	return redactor.With(chartConfig(ch).Sensitive...)
+}
+
+// Return a copy of the release with the secrets in its values, its
+// manifest and the manifests of its hooks masked.
+func redactRelease(redactor *redact.Redactor, rel *release.Release) *release.Release {
+	if rel == nil {
+		return nil
+	}
+	redacted := *rel
+	redacted.Manifest = redact.Manifest(rel.Manifest)
+	redacted.Hooks = make([]*release.Hook, len(rel.Hooks))
+	for i, hook := range rel.Hooks {
+		h := *hook
+		h.Manifest = redact.Manifest(hook.Manifest)
+		redacted.Hooks[i] = &h
+	}
+	if rel.Config != nil {
+		raw, err := chartRedactor(redactor, rel.Chart).RawValues(rel.Config.Raw)
+		if err != nil {
+			raw = ""
+		}
+		redacted.Config = &chart.Config{Raw: raw}
+	}
+
+	return &redacted
+}
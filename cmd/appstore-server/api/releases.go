@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ghodss/yaml"
@@ -13,10 +14,19 @@ import (
 
 	"github.com/golang/protobuf/ptypes"
 
+	"github.com/UNINETT/appstore/pkg/audit"
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/dataporten"
 	"github.com/UNINETT/appstore/pkg/helmutil"
+	"github.com/UNINETT/appstore/pkg/hostnames"
+	"github.com/UNINETT/appstore/pkg/identity"
 	"github.com/UNINETT/appstore/pkg/install"
 	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/policy"
+	"github.com/UNINETT/appstore/pkg/quota"
+	"github.com/UNINETT/appstore/pkg/redact"
 	"github.com/UNINETT/appstore/pkg/releaseutil"
+	"github.com/UNINETT/appstore/pkg/schema"
 	"github.com/UNINETT/appstore/pkg/status"
 
 	"k8s.io/helm/pkg/helm"
@@ -30,16 +40,24 @@ const (
 
 // Delete the release with release name releaseName.
 // If the release is associated with a dataporten application, attempt to delete this as well.
-func deleteReleaseHandler(context context.Context, releaseName string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+func deleteReleaseHandler(context context.Context, event *audit.Event, dp *dataporten.Client, redactor *redact.Redactor, releaseName string, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
 	if releaseName == "" {
 		return http.StatusNotFound, nil, fmt.Errorf("no release provided")
 	}
-	client := helmutil.InitHelmClient(settings)
+	client := helmutil.InitHelmClient(context, settings)
 
 	rd, err := getReleaseDetails(releaseName, client, logger)
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
+	logger = logTarget(context, logger, rd.Namespace, "")
+	event.Namespace = rd.Namespace
+	event.Package = rd.Chart.GetMetadata().GetName()
+	event.Version = rd.Chart.GetMetadata().GetVersion()
+	httpStatus, err := authorizeRelease(context, namespaceMappings, rd.Namespace, rd.AppstoreMetaData.Owner)
+	if err != nil {
+		return httpStatus, nil, err
+	}
 
 	status, err := client.DeleteRelease(releaseName)
 	logger.Debugf("Attemping to delete: %s", releaseName)
@@ -48,19 +66,22 @@ func deleteReleaseHandler(context context.Context, releaseName string, settings
 	}
 	logger.Debugf("Successfully deleted: %s", releaseName)
 
-	httpStatus, _, err := deleteClientHandler(context, rd.Values, logger)
+	httpStatus, _, err = deleteClientHandler(context, dp, rd.Values, logger)
 	if err != nil {
 		return httpStatus, nil, err
 	}
+	status.Release = redactRelease(redactor, status.Release)
 
 	return http.StatusOK, status, nil
 }
 
-func makeDeleteReleaseHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeDeleteReleaseHandler(settings *helm_env.EnvSettings, dp *dataporten.Client, redactor *redact.Redactor, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
 		releaseName := chi.URLParam(r, "releaseName")
-		status, res, err := deleteReleaseHandler(r.Context(), releaseName, settings, apiReqLogger)
+		event := &audit.Event{Action: audit.ActionDelete, Release: releaseName}
+		status, res, err := deleteReleaseHandler(r.Context(), event, dp, redactor, releaseName, namespaceMappings, settings, apiReqLogger)
+		recordAudit(r.Context(), event, status, err, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
@@ -86,6 +107,24 @@ func getPackageMetaData(values map[string]interface{}) (*PackageAppstoreMetaData
 				return nil, fmt.Errorf("invalid package metadata")
 			}
 			md.Repo = repo
+		case "owner":
+			owner, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid package metadata")
+			}
+			md.Owner = owner
+		case "group":
+			group, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid package metadata")
+			}
+			md.Group = group
+		case "defaults":
+			defaults, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid package metadata")
+			}
+			md.Defaults = defaults
 		}
 	}
 
@@ -122,38 +161,90 @@ func getReleaseDetails(releaseName string, client helm.Interface, logger *logrus
 
 // For the release with release name releaseName, get the same
 // information about a release that was returned to the user when
-// installing (i.e. the passed values etc.) the release.
-func releaseDetailHandler(releaseName string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+// installing (i.e. the passed values etc.) the release. Secrets in the
+// values are masked, see releaseSecretsHandler.
+func releaseDetailHandler(context context.Context, redactor *redact.Redactor, releaseName string, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
 	if releaseName == "" {
 		return http.StatusNotFound, nil, fmt.Errorf("no release provided")
 	}
-	client := helmutil.InitHelmClient(settings)
+	client := helmutil.InitHelmClient(context, settings)
 	rd, err := getReleaseDetails(releaseName, client, logger)
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
+	logger = logTarget(context, logger, rd.Namespace, "")
+	status, err := authorizeRelease(context, namespaceMappings, rd.Namespace, rd.AppstoreMetaData.Owner)
+	if err != nil {
+		return status, nil, err
+	}
+
+	return describeRelease(rd, chartRedactor(redactor, rd.Chart).Values(rd.Values))
+}
 
+func describeRelease(rd *ReleaseDetails, values map[string]interface{}) (int, interface{}, error) {
 	chartMetaData := rd.Chart.GetMetadata()
 	if chartMetaData == nil {
 		return http.StatusInternalServerError, nil, fmt.Errorf("failed to get chart metadata")
 	}
 
-	desiredDetails := releaseutil.Release{ReleaseSettings: &releaseutil.ReleaseSettings{Repo: rd.AppstoreMetaData.Repo, Version: chartMetaData.Version, Values: rd.Values, Package: chartMetaData.Name}, Id: rd.Name, Namespace: rd.Namespace}
+	desiredDetails := releaseutil.Release{ReleaseSettings: &releaseutil.ReleaseSettings{Repo: rd.AppstoreMetaData.Repo, Version: chartMetaData.Version, Values: values, Package: chartMetaData.Name}, Id: rd.Name, Namespace: rd.Namespace}
 
 	return http.StatusOK, desiredDetails, nil
 }
 
-func makeReleaseDetailHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeReleaseDetailHandler(settings *helm_env.EnvSettings, redactor *redact.Redactor, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
 		releaseName := chi.URLParam(r, "releaseName")
-		status, res, err := releaseDetailHandler(releaseName, settings, apiReqLogger)
+		status, res, err := releaseDetailHandler(r.Context(), redactor, releaseName, namespaceMappings, settings, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
 }
 
+// Like releaseDetailHandler, but with the secrets revealed. Only
+// namespace admins may see them, and every attempt is audited.
+func releaseSecretsHandler(context context.Context, event *audit.Event, releaseName string, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+	if releaseName == "" {
+		return http.StatusNotFound, nil, fmt.Errorf("no release provided")
+	}
+	client := helmutil.InitHelmClient(context, settings)
+	rd, err := getReleaseDetails(releaseName, client, logger)
+
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	logger = logTarget(context, logger, rd.Namespace, "")
+	event.Namespace = rd.Namespace
+	event.Package = rd.Chart.GetMetadata().GetName()
+	event.Version = rd.Chart.GetMetadata().GetVersion()
+	status, err := authorizeNamespace(context, namespaceMappings, rd.Namespace, config.RoleAdmin)
+	if err != nil {
+		return status, nil, err
+	}
+
+	return describeRelease(rd, rd.Values)
+}
+
+func makeReleaseSecretsHandler(settings *helm_env.EnvSettings, namespaceMappings config.MappingSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiReqLogger := logger.MakeAPILogger(r)
+		releaseName := chi.URLParam(r, "releaseName")
+		event := &audit.Event{Action: audit.ActionRevealSecrets, Release: releaseName}
+		status, res, err := releaseSecretsHandler(r.Context(), event, releaseName, namespaceMappings, settings, apiReqLogger)
+		recordAudit(r.Context(), event, status, err, apiReqLogger)
+
+		returnJSON(w, r, res, err, status)
+	}
+}
+
+// Whether err is the error of Tiller for a release which doesn't exist.
+func isReleaseNotFound(err error) bool {
+	return err != nil && strings.HasSuffix(err.Error(), " not found")
+}
+
 type releaseStatus struct {
 	Name         string                       `json:"name"`
 	LastDeployed string                       `json:"last_deployed"`
@@ -165,54 +256,92 @@ type releaseStatus struct {
 // For the release with release name releaseName, get status related
 // information (i.e. whether the release is deployed, which resources it
 // is using etc.)
-func releaseStatusHandler(releaseName string, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+func releaseStatusHandler(context context.Context, releaseName string, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
 	if releaseName == "" {
 		return http.StatusNotFound, nil, fmt.Errorf("no release provided")
 	}
-	client := helmutil.InitHelmClient(settings)
+	client := helmutil.InitHelmClient(context, settings)
 	logger.Debugf("Attemping to fetch the status of: %s", releaseName)
 	rs, err := client.ReleaseStatus(releaseName)
+	if isReleaseNotFound(err) {
+		return http.StatusNotFound, nil, fmt.Errorf("release %s not found", releaseName)
+	}
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
+	logger = logTarget(context, logger, rs.Namespace, "")
+	status, err := authorizeNamespace(context, namespaceMappings, rs.Namespace, config.RoleViewer)
+	if status == http.StatusForbidden {
+		// Users who can't see the namespace are not told whether the
+		// release exists.
+		logger.Debugf("Hiding the release from the user: %s", err.Error())
+		return http.StatusNotFound, nil, fmt.Errorf("release %s not found", releaseName)
+	}
+	if err != nil {
+		return status, nil, err
+	}
 
 	info := rs.Info
 	resources := releaseutil.ParseResources(info.Status.Resources)
 	return http.StatusOK, releaseStatus{releaseName, ptypes.TimestampString(info.GetLastDeployed()), rs.Namespace, info.Status.Code.String(), resources}, err
 }
 
-func makeReleaseStatusHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeReleaseStatusHandler(settings *helm_env.EnvSettings, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
 		releaseName := chi.URLParam(r, "releaseName")
-		status, res, err := releaseStatusHandler(releaseName, settings, apiReqLogger)
+		status, res, err := releaseStatusHandler(r.Context(), releaseName, namespaceMappings, settings, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
 }
 
-func ReleaseOverviewHandler(settings *helm_env.EnvSettings, logger *logrus.Entry) (int, []*release.Release, error) {
-	res, err := status.GetAllReleases(settings, logger)
+// List the releases in the namespaces where the user is at least a
+// viewer.
+func ReleaseOverviewHandler(context context.Context, redactor *redact.Redactor, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, []*release.Release, error) {
+	roles, err := userRoles(context, namespaceMappings)
+	if err != nil {
+		return http.StatusUnauthorized, nil, err
+	}
+
+	res, err := status.GetAllReleases(context, settings, logger)
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
-	return http.StatusOK, res, nil
+
+	visible := make([]*release.Release, 0, len(res))
+	for _, rel := range res {
+		if roles[rel.Namespace].Includes(config.RoleViewer) {
+			visible = append(visible, redactRelease(redactor, rel))
+		}
+	}
+	return http.StatusOK, visible, nil
 }
 
-func makeReleaseOverviewHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeReleaseOverviewHandler(settings *helm_env.EnvSettings, redactor *redact.Redactor, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
-		status, res, err := ReleaseOverviewHandler(settings, apiReqLogger)
+		status, res, err := ReleaseOverviewHandler(r.Context(), redactor, namespaceMappings, settings, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
 }
 
+// The context value templates are rendered with when user installs or
+// upgrades a release.
+func templateContext(user *identity.Identity, namespace string, releaseName string, packageName string) *install.TemplateContext {
+	return &install.TemplateContext{
+		User:      install.TemplateUser{ID: user.UserId, Name: user.Name, Groups: user.Groups},
+		Namespace: namespace,
+		Release:   install.TemplateRelease{Name: releaseName, Package: packageName},
+	}
+}
+
 // Install a release using the provided values and settings, should
 // return the same values that was posted along with some extra
 // information, such as which namespace it was actually deployed in etc.
-func installReleaseHandler(context context.Context, releaseSettingsRaw io.ReadCloser, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+func installReleaseHandler(context context.Context, event *audit.Event, dp *dataporten.Client, redactor *redact.Redactor, schemas *schema.Registry, policies *policy.Policy, hosts *hostnames.Allocator, locks *quota.Locks, releaseSettingsRaw io.ReadCloser, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
 
 	releaseSettings := &releaseutil.ReleaseSettings{Repo: "stable"}
 	decoder := json.NewDecoder(releaseSettingsRaw)
@@ -223,41 +352,162 @@ func installReleaseHandler(context context.Context, releaseSettingsRaw io.ReadCl
 		return http.StatusBadRequest, nil, fmt.Errorf("invalid json")
 	}
 
-	status, chartRequested, err := PackageDetailHandler(releaseSettings.Package, releaseSettings.Repo, releaseSettings.Version, settings, logger)
+	if releaseSettings.Namespace == "" {
+		return http.StatusBadRequest, nil, fmt.Errorf("namespace not specified")
+	}
+	logger = logTarget(context, logger, releaseSettings.Namespace, "")
+	event.Namespace = releaseSettings.Namespace
+	event.Package = releaseSettings.Package
+	event.Version = releaseSettings.Version
+	status, err := authorizeNamespace(context, namespaceMappings, releaseSettings.Namespace, config.RoleDeployer)
+	if err != nil {
+		return status, nil, err
+	}
+	user, _ := identity.FromContext(context)
+	mapping := config.FindNamespace(namespaceMappings.Mappings(), releaseSettings.Namespace)
+	// Releases are counted against the group of the user which gave
+	// access, rather than the pattern in the mapping matching it.
+	var group string
+	if mapping != nil {
+		group = mapping.GrantedSubject(config.NewSubjectSet(user.Groups))
+	}
+	status, chartRequested, err := PackageDetailHandler(context, releaseSettings.Package, releaseSettings.Repo, releaseSettings.Version, settings, logger)
 	if status != http.StatusOK {
 		return status, nil, err
 	}
+	event.Version = chartRequested.GetMetadata().GetVersion()
+	releaseName, err := install.GenerateReleaseName(chartRequested.GetMetadata().GetName())
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	logger = logTarget(context, logger, "", releaseName)
+	event.Release = releaseName
+	ctx := templateContext(user, releaseSettings.Namespace, releaseName, releaseSettings.Package)
+	if releaseSettings.Values == nil {
+		releaseSettings.Values = make(map[string]interface{})
+	}
+	err = install.RenderValues(releaseSettings.Values, ctx)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	var defaults map[string]interface{}
+	releaseSettings.Values, defaults, err = namespaceValues(releaseSettings.Values, mapping, ctx)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	status, err = assignHost(mapping, releaseName, releaseSettings.Values, nil, true, logger)
+	if err != nil {
+		return status, nil, err
+	}
+	event.Diff = valuesDiff(chartRedactor(redactor, chartRequested), nil, releaseSettings.Values)
+	status, err = validateValues(schemas, chartRequested, releaseSettings.Values)
+	if err != nil {
+		return status, nil, err
+	}
+
+	// The quota is checked against the releases in Tiller, so concurrent
+	// installs must wait until this one is visible there.
+	if mapping != nil && mapping.Quota != nil {
+		unlock, status, err := lockNamespace(context, locks, mapping.NamespaceId)
+		if err != nil {
+			return status, nil, err
+		}
+		defer unlock()
+	}
+	usage, status, err := checkReleaseQuota(context, mapping, user.UserId, group, settings, logger)
+	if err != nil {
+		return status, nil, err
+	}
+	releaseHost, status, err := allocateHost(context, hosts, mapping, namespaceMappings, releaseName, releaseSettings.Values, settings, logger)
+	if err != nil {
+		return status, nil, err
+	}
+	defer releaseHost()
 
-	status, dataportenRes, err := createClientHandler(context, releaseSettings, settings, logger)
+	status, dataportenRes, err := createClientHandler(context, dp, releaseSettings, settings, logger)
 	if err != nil {
 		return status, nil, err
 	}
-	releaseSettings.Values[dataportenAppstoreSettingsKey] = dataportenRes
+	if dataportenRes != nil {
+		releaseSettings.Values[dataportenAppstoreSettingsKey] = dataportenRes
+	}
 
-	releaseSettings.Values[appstoreMetaDataKey] = PackageAppstoreMetaData{Repo: releaseSettings.Repo}
-	res, err := install.InstallChart(chartRequested, releaseSettings.Namespace, releaseSettings.Values, settings, logger)
+	releaseSettings.Values[appstoreMetaDataKey] = PackageAppstoreMetaData{Repo: releaseSettings.Repo, Owner: user.UserId, Group: group, Defaults: defaults}
+	if needsDryRun(policies, mapping) {
+		// The release is rendered with the Dataporten settings, which the
+		// templates may depend on.
+		dryRun, err := install.DryRunInstallChart(context, chartRequested, releaseName, releaseSettings.Namespace, releaseSettings.Values, settings, logger)
+		status = http.StatusInternalServerError
+		if err == nil {
+			status, err = checkRendered(policies, mapping, usage, releaseSettings.Namespace, dryRun)
+		}
+		if err != nil {
+			_, _, _ = deleteClientHandler(context, dp, releaseSettings.Values, logger)
+			return status, nil, err
+		}
+	}
+	res, err := install.InstallChart(context, chartRequested, releaseName, releaseSettings.Namespace, releaseSettings.Values, settings, logger)
 
-	// TODO: give a better error
 	if err != nil {
-		_, _, _ = deleteClientHandler(context, releaseSettings.Values, logger)
-		return http.StatusOK, nil, nil
+		_, _, _ = deleteClientHandler(context, dp, releaseSettings.Values, logger)
+		return http.StatusInternalServerError, nil, err
 	}
 
 	releaseSettings.Version = res.Chart.Metadata.Version
+	releaseSettings.Values = chartRedactor(redactor, chartRequested).Values(releaseSettings.Values)
 	release := releaseutil.Release{Id: res.Name, Namespace: res.Namespace, ReleaseSettings: releaseSettings}
 	return http.StatusOK, release, nil
 }
 
-func makeInstallReleaseHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeInstallReleaseHandler(settings *helm_env.EnvSettings, dp *dataporten.Client, redactor *redact.Redactor, schemas *schema.Registry, policies *policy.Policy, hosts *hostnames.Allocator, locks *quota.Locks, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
 
-		status, res, err := installReleaseHandler(r.Context(), r.Body, settings, apiReqLogger)
+		event := &audit.Event{Action: audit.ActionInstall}
+		status, res, err := installReleaseHandler(r.Context(), event, dp, redactor, schemas, policies, hosts, locks, r.Body, namespaceMappings, settings, apiReqLogger)
+		recordAudit(r.Context(), event, status, err, apiReqLogger)
 
 		returnJSON(w, r, res, err, status)
 	}
 }
 
+// Apply the default and enforced values of the namespace of mapping to
+// the user's values, rendering them with ctx. The user's values are
+// expected to be rendered already. Returns the values and the rendered
+// defaults, which are kept with the release.
+func namespaceValues(values map[string]interface{}, mapping *config.NamespaceMapping, ctx *install.TemplateContext) (map[string]interface{}, map[string]interface{}, error) {
+	if mapping == nil {
+		return values, nil, nil
+	}
+	defaultValues := install.ApplyNamespaceValues(nil, mapping.DefaultValues, nil)
+	enforcedValues := install.ApplyNamespaceValues(nil, nil, mapping.EnforcedValues)
+	for _, v := range []map[string]interface{}{defaultValues, enforcedValues} {
+		if err := install.RenderValues(v, ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return install.ApplyNamespaceValues(values, defaultValues, enforcedValues), defaultValues, nil
+}
+
+// The values a release is upgraded with. The defaults stored with the
+// release in md are taken out of the stored values, leaving the user's,
+// and the current default and enforced values of the namespace are
+// applied to them. The stored values were rendered on install, so only
+// the values of the namespace are rendered. The stored values are not
+// modified, to be compared with the new ones.
+func upgradeValues(stored map[string]interface{}, md *PackageAppstoreMetaData, mapping *config.NamespaceMapping, ctx *install.TemplateContext) (map[string]interface{}, error) {
+	values, defaults, err := namespaceValues(install.RemoveDefaultValues(stored, md.Defaults), mapping, ctx)
+	if err != nil {
+		return nil, err
+	}
+	updated := *md
+	updated.Defaults = defaults
+	values[appstoreMetaDataKey] = updated
+
+	return values, nil
+}
+
 type UpgradeReleaseSettings struct {
 	Version string `json:"version"`
 }
@@ -265,7 +515,7 @@ type UpgradeReleaseSettings struct {
 // Upgrade the release with release name releaseName to the provided
 // version (this may actually be a downgrade). The handler attempts to
 // use the same repo and package name as the release was deployed with.
-func upgradeReleaseHandler(releaseName string, upgradeSettingsRaw io.ReadCloser, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
+func upgradeReleaseHandler(context context.Context, event *audit.Event, redactor *redact.Redactor, schemas *schema.Registry, policies *policy.Policy, hosts *hostnames.Allocator, locks *quota.Locks, releaseName string, upgradeSettingsRaw io.ReadCloser, namespaceMappings config.MappingSource, settings *helm_env.EnvSettings, logger *logrus.Entry) (int, interface{}, error) {
 	var upgradeSettings UpgradeReleaseSettings
 	decoder := json.NewDecoder(upgradeSettingsRaw)
 	err := decoder.Decode(&upgradeSettings)
@@ -279,7 +529,7 @@ func upgradeReleaseHandler(releaseName string, upgradeSettingsRaw io.ReadCloser,
 		return http.StatusBadRequest, nil, fmt.Errorf("release not specified")
 	}
 
-	client := helmutil.InitHelmClient(settings)
+	client := helmutil.InitHelmClient(context, settings)
 
 	// We need some more information about the package (such as the repo
 	// and package) before we can attempt to upgrade it
@@ -288,32 +538,98 @@ func upgradeReleaseHandler(releaseName string, upgradeSettingsRaw io.ReadCloser,
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
+	logger = logTarget(context, logger, rd.Namespace, "")
+	event.Namespace = rd.Namespace
+	status, err := authorizeRelease(context, namespaceMappings, rd.Namespace, rd.AppstoreMetaData.Owner)
+	if err != nil {
+		return status, nil, err
+	}
 
 	chartMetaData := rd.Chart.GetMetadata()
 	if chartMetaData == nil {
 		return http.StatusInternalServerError, nil, fmt.Errorf("failed to get chart metadata")
 	}
+	event.Package = chartMetaData.Name
+	event.PreviousVersion = chartMetaData.Version
+	event.Version = upgradeSettings.Version
 
 	// TODO: Handle TLS related things:
-	chartPath, err := install.LocateChartPath(chartMetaData.Name, rd.AppstoreMetaData.Repo, upgradeSettings.Version, false, "", settings, logger)
+	chartPath, err := install.LocateChartPath(context, chartMetaData.Name, rd.AppstoreMetaData.Repo, upgradeSettings.Version, false, "", settings, logger)
 	if err != nil {
 		return http.StatusNotFound, nil, err
 	}
 
-	res, err := client.UpdateRelease(releaseName, chartPath)
+	mapping := config.FindNamespace(namespaceMappings.Mappings(), rd.Namespace)
+	user, _ := identity.FromContext(context)
+	values, err := upgradeValues(rd.Values, rd.AppstoreMetaData, mapping, templateContext(user, rd.Namespace, releaseName, chartMetaData.Name))
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	chartRequested, err := install.LoadChart(context, chartPath)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	event.Version = chartRequested.GetMetadata().GetVersion()
+	status, err = assignHost(mapping, releaseName, values, rd.Values, false, logger)
+	if err != nil {
+		return status, nil, err
+	}
+	event.Diff = valuesDiff(chartRedactor(redactor, chartRequested), rd.Values, values)
+	status, err = validateValues(schemas, chartRequested, values)
+	if err != nil {
+		return status, nil, err
+	}
+	releaseHost, status, err := allocateHost(context, hosts, mapping, namespaceMappings, releaseName, values, settings, logger)
+	if err != nil {
+		return status, nil, err
+	}
+	defer releaseHost()
+	rawVals, err := yaml.Marshal(values)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if needsDryRun(policies, mapping) {
+		dryRun, err := client.UpdateRelease(releaseName, chartPath, helm.UpdateValueOverrides(rawVals), helm.UpgradeDryRun(true))
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		// The release replaces its previous revision in the usage.
+		var usage *quota.Usage
+		if mapping != nil && mapping.Quota.LimitsResources() {
+			unlock, status, err := lockNamespace(context, locks, mapping.NamespaceId)
+			if err != nil {
+				return status, nil, err
+			}
+			defer unlock()
+			usage, err = namespaceUsage(context, rd.Namespace, releaseName, settings, logger)
+			if err != nil {
+				return http.StatusInternalServerError, nil, err
+			}
+		}
+		status, err = checkRendered(policies, mapping, usage, rd.Namespace, dryRun.GetRelease())
+		if err != nil {
+			return status, nil, err
+		}
+	}
+
+	res, err := client.UpdateRelease(releaseName, chartPath, helm.UpdateValueOverrides(rawVals))
 
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
 	}
+	res.Release = redactRelease(redactor, res.Release)
 
 	return http.StatusOK, res, nil
 }
 
-func makeUpgradeReleaseHandler(settings *helm_env.EnvSettings) http.HandlerFunc {
+func makeUpgradeReleaseHandler(settings *helm_env.EnvSettings, redactor *redact.Redactor, schemas *schema.Registry, policies *policy.Policy, hosts *hostnames.Allocator, locks *quota.Locks, namespaceMappings config.MappingSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		apiReqLogger := logger.MakeAPILogger(r)
 		releaseName := chi.URLParam(r, "releaseName")
-		status, res, err := upgradeReleaseHandler(releaseName, r.Body, settings, apiReqLogger)
+		event := &audit.Event{Action: audit.ActionUpgrade, Release: releaseName}
+		status, res, err := upgradeReleaseHandler(r.Context(), event, redactor, schemas, policies, hosts, locks, releaseName, r.Body, namespaceMappings, settings, apiReqLogger)
+		recordAudit(r.Context(), event, status, err, apiReqLogger)
 		returnJSON(w, r, res, err, status)
 	}
 }
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/identity"
+)
+
+// The role of the user in each namespace it has access to.
+func userRoles(context context.Context, namespaceMappings config.MappingSource) (map[string]config.Role, error) {
+	user, found := identity.FromContext(context)
+	if !found {
+		return nil, identity.ErrUnauthenticated
+	}
+
+	groups := config.NewSubjectSet(user.Groups)
+	roles := make(map[string]config.Role)
+	for _, n := range namespaceMappings.Mappings() {
+		if role, _ := n.Grant(groups); role != config.RoleNone {
+			roles[n.NamespaceId] = role
+		}
+	}
+
+	return roles, nil
+}
+
+// Check that the user has at least the required role in namespace.
+func authorizeNamespace(context context.Context, namespaceMappings config.MappingSource, namespace string, required config.Role) (int, error) {
+	roles, err := userRoles(context, namespaceMappings)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	if !roles[namespace].Includes(required) {
+		return http.StatusForbidden, fmt.Errorf("the %s role is required in namespace %s", required, namespace)
+	}
+
+	return http.StatusOK, nil
+}
+
+// Check that the user may manage a release in namespace installed by
+// owner: admins may manage every release, deployers only their own.
+func authorizeRelease(context context.Context, namespaceMappings config.MappingSource, namespace string, owner string) (int, error) {
+	roles, err := userRoles(context, namespaceMappings)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+	user, _ := identity.FromContext(context)
+
+	role := roles[namespace]
+	if role.Includes(config.RoleAdmin) || (role.Includes(config.RoleDeployer) && owner != "" && owner == user.UserId) {
+		return http.StatusOK, nil
+	}
+
+	return http.StatusForbidden, fmt.Errorf("not allowed to manage releases owned by others in namespace %s", namespace)
+}
@@ -4,13 +4,57 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/go-chi/chi"
 
-	helm_env "k8s.io/helm/pkg/helm/environment"
+	"github.com/UNINETT/appstore/pkg/audit"
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/hostnames"
+	"github.com/UNINETT/appstore/pkg/identity"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/policy"
+	"github.com/UNINETT/appstore/pkg/quota"
+	"github.com/UNINETT/appstore/pkg/ratelimit"
+	"github.com/UNINETT/appstore/pkg/redact"
+	"github.com/UNINETT/appstore/pkg/schema"
 
-	auth "scm.uninett.no/laas/laasctl-auth"
+	helm_env "k8s.io/helm/pkg/helm/environment"
 )
 
+// Options used when creating the API router.
+type Options struct {
+	Settings *helm_env.EnvSettings
+	// Middleware authenticating the user on the routes which require a
+	// X-Dataporten-Token. Optional, as the identity provider may
+	// authenticate the user by itself.
+	AuthMiddleware   func(next http.Handler) http.Handler
+	IdentityProvider identity.IdentityProvider
+	// Registers the Dataporten clients of releases. Optional, releases
+	// get no Dataporten client without it.
+	Dataporten *dataporten.Client
+	// The mapping from namespaces to subjects.
+	NamespaceMappings config.MappingSource
+	// Members of these groups may use the admin endpoints.
+	AdminGroups []string
+	// Paths of values masked in release responses, in addition to
+	// redact.DefaultPaths.
+	SecretPaths []string
+	// Schemas of the values of charts without a values.schema.json.
+	Schemas *schema.Registry
+	// Rules the manifests of releases must follow. Optional.
+	Policy *policy.Policy
+	// Where changes to releases are recorded.
+	Audit audit.Sink
+	// Limits the requests of each user, or of each address on the routes
+	// not requiring authentication. Optional.
+	RateLimiter *ratelimit.Limiter
+	// Limits the requests of each address before the user is identified,
+	// so that requests with invalid tokens don't reach the identity
+	// provider without limit. Optional.
+	AddressRateLimiter *ratelimit.Limiter
+}
+
 func tokenCtx(tokenHeaderKey string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -22,6 +66,29 @@ func tokenCtx(tokenHeaderKey string) func(next http.Handler) http.Handler {
 	}
 }
 
+// Resolve the user making the request, and make the identity available
+// to the handlers. Requests without a valid identity are rejected.
+func identityCtx(provider identity.IdentityProvider) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := provider.Identify(r, logger.MakeAPILogger(r))
+			if err != nil {
+				returnJSON(w, r, nil, err, identity.HTTPStatus(err))
+				return
+			}
+			logger.SetUser(r.Context(), id.UserId, len(id.Groups))
+			r = r.WithContext(identity.NewContext(r.Context(), id))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Log the namespace and release a request targets, once the handler
+// knows them.
+func logTarget(ctx context.Context, entry *logrus.Entry, namespace string, release string) *logrus.Entry {
+	return logger.WithTarget(ctx, entry, namespace, release)
+}
+
 func apiVersionCtx(version string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -31,40 +98,58 @@ func apiVersionCtx(version string) func(next http.Handler) http.Handler {
 	}
 }
 
-func createNamespacesRouter(settings *helm_env.EnvSettings) http.Handler {
+func createNamespacesRouter(settings *helm_env.EnvSettings, namespaceMappings config.MappingSource) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/", makeListNamespacesHandler(settings))
+	r.Get("/", makeListNamespacesHandler(settings, namespaceMappings))
+	r.Get("/{namespaceId}", makeNamespaceDetailHandler(namespaceMappings))
+	r.Get("/{namespaceId}/usage", makeNamespaceUsageHandler(settings, namespaceMappings))
 	return r
 }
 
-func createPackagesRouter(settings *helm_env.EnvSettings) http.Handler {
+func createPackagesRouter(settings *helm_env.EnvSettings, schemas *schema.Registry) http.Handler {
 	r := chi.NewRouter()
 	r.Get("/", makeListPackagesHandler(settings))
 	r.Get("/{packageName}", makePackageDetailHandler(settings))
+	r.Get("/{packageName}/form", makePackageFormHandler(settings, schemas))
 	return r
 }
 
-func createReleaseRouter(settings *helm_env.EnvSettings) http.Handler {
+func createReleaseRouter(settings *helm_env.EnvSettings, dp *dataporten.Client, redactor *redact.Redactor, schemas *schema.Registry, policies *policy.Policy, namespaceMappings config.MappingSource) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/", makeReleaseOverviewHandler(settings))
-	r.Post("/", makeInstallReleaseHandler(settings))
+	hosts := hostnames.NewAllocator()
+	locks := quota.NewLocks()
+	r.Get("/", makeReleaseOverviewHandler(settings, redactor, namespaceMappings))
+	r.Post("/", makeInstallReleaseHandler(settings, dp, redactor, schemas, policies, hosts, locks, namespaceMappings))
 	r.Route("/{releaseName}", func(sr chi.Router) {
-		sr.Get("/", makeReleaseDetailHandler(settings))
-		sr.Patch("/", makeUpgradeReleaseHandler(settings))
-		sr.Delete("/", makeDeleteReleaseHandler(settings))
-		sr.Get("/status", makeReleaseStatusHandler(settings))
+		sr.Get("/", makeReleaseDetailHandler(settings, redactor, namespaceMappings))
+		sr.Patch("/", makeUpgradeReleaseHandler(settings, redactor, schemas, policies, hosts, locks, namespaceMappings))
+		sr.Delete("/", makeDeleteReleaseHandler(settings, dp, redactor, namespaceMappings))
+		sr.Get("/status", makeReleaseStatusHandler(settings, namespaceMappings))
+		sr.Get("/secrets", makeReleaseSecretsHandler(settings, namespaceMappings))
 	})
 	return r
 }
 
-func CreateAPIRouter(settings *helm_env.EnvSettings) http.Handler {
+func CreateAPIRouter(opts *Options) http.Handler {
+	settings := opts.Settings
+	redactor := redact.NewRedactor(redact.DefaultPaths).With(opts.SecretPaths...)
 	baseAPIrouter := chi.NewRouter()
 
 	baseAPIrouter.Route("/v1", func(baseAPIrouter chi.Router) {
 		baseAPIrouter.Use(apiVersionCtx("v1"))
-		baseAPIrouter.Mount("/packages", createPackagesRouter(settings))
-		baseAPIrouter.With(auth.MiddlewareHandler, tokenCtx("X-Dataporten-Token")).Mount("/releases", createReleaseRouter(settings))
-		baseAPIrouter.With(auth.MiddlewareHandler, tokenCtx("X-Dataporten-Token")).Mount("/namespaces", createNamespacesRouter(settings))
+		rateLimit := rateLimitCtx(opts.RateLimiter, rateLimitKey)
+		baseAPIrouter.With(rateLimit).Mount("/packages", createPackagesRouter(settings, opts.Schemas))
+		authMiddlewares := []func(http.Handler) http.Handler{rateLimitCtx(opts.AddressRateLimiter, addressKey)}
+		if opts.AuthMiddleware != nil {
+			authMiddlewares = append(authMiddlewares, opts.AuthMiddleware)
+		}
+		authMiddlewares = append(authMiddlewares, tokenCtx("X-Dataporten-Token"), identityCtx(opts.IdentityProvider), rateLimit, auditCtx(opts.Audit))
+
+		authenticated := baseAPIrouter.With(authMiddlewares...)
+		authenticated.Mount("/releases", createReleaseRouter(settings, opts.Dataporten, redactor, opts.Schemas, opts.Policy, opts.NamespaceMappings))
+		authenticated.Mount("/namespaces", createNamespacesRouter(settings, opts.NamespaceMappings))
+		authenticated.With(adminCtx(opts.AdminGroups)).Mount("/admin", createAdminRouter(opts.NamespaceMappings))
+		authenticated.With(adminCtx(opts.AdminGroups)).Get("/audit", makeAuditHandler(opts.Audit))
 	})
 
 	return baseAPIrouter
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/UNINETT/appstore/pkg/schema"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+)
+
+// The schema of the values of the chart, either from the chart itself
+// or from the registry.
+func valuesSchema(registry *schema.Registry, ch *chart.Chart) ([]byte, bool, error) {
+	for _, f := range ch.GetFiles() {
+		if f.TypeUrl == schema.ChartSchemaFile {
+			return f.Value, true, nil
+		}
+	}
+	metadata := ch.GetMetadata()
+	if metadata == nil {
+		return nil, false, nil
+	}
+
+	return registry.Lookup(metadata.Name, metadata.Version)
+}
+
+// The values of a release without the settings added by the appstore
+// itself, which are not part of the values of the chart.
+func chartValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if k != appstoreMetaDataKey && k != dataportenAppstoreSettingsKey {
+			c[k] = v
+		}
+	}
+
+	return c
+}
+
+// Validate the values of a release, merged with the default values of
+// the chart, against the schema of the chart. Charts without a schema
+// accept any values.
+func validateValues(registry *schema.Registry, ch *chart.Chart, values map[string]interface{}) (int, error) {
+	s, found, err := valuesSchema(registry, ch)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !found {
+		return http.StatusOK, nil
+	}
+
+	rawVals, err := yaml.Marshal(chartValues(values))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	merged, err := chartutil.CoalesceValues(ch, &chart.Config{Raw: string(rawVals)})
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	err = schema.Validate(s, merged)
+	if _, invalid := err.(*schema.ValidationError); invalid {
+		return http.StatusUnprocessableEntity, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+
+	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/tracing"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// A duration given as e.g. "90s" in the config file.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"90s\": %s", err.Error())
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+
+	return nil
+}
+
+// A list given as a comma separated string in flags and environment
+// variables, and as a list in the config file.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+
+	return nil
+}
+
+// The configuration of the server. It is built from the defaults, the
+// optional config file, the environment variables and the flags, each
+// overriding the ones before. The keys of the config file are the names
+// of the flags.
+type Config struct {
+	// Not read from the config file, which it points to.
+	ConfigFile string `json:"-"`
+
+	Debug           bool     `json:"debug"`
+	Port            int      `json:"port"`
+	TLSCertFile     string   `json:"tls-cert-file"`
+	TLSKeyFile      string   `json:"tls-key-file"`
+	MetricsAddr     string   `json:"metrics-addr"`
+	ReadTimeout     duration `json:"read-timeout"`
+	WriteTimeout    duration `json:"write-timeout"`
+	IdleTimeout     duration `json:"idle-timeout"`
+	RequestTimeout  duration `json:"request-timeout"`
+	InstallTimeout  duration `json:"install-timeout"`
+	ShutdownTimeout duration `json:"shutdown-timeout"`
+	TillerHost      string   `json:"host"`
+	Mode            string   `json:"mode"`
+
+	CORSAllowedOrigins   stringList `json:"cors-allowed-origins"`
+	CORSAllowedMethods   stringList `json:"cors-allowed-methods"`
+	CORSAllowedHeaders   stringList `json:"cors-allowed-headers"`
+	CORSAllowCredentials bool       `json:"cors-allow-credentials"`
+	CORSMaxAge           duration   `json:"cors-max-age"`
+
+	RateLimitRead    int      `json:"rate-limit-read"`
+	RateLimitWrite   int      `json:"rate-limit-write"`
+	RateLimitAddress int      `json:"rate-limit-address"`
+	RateLimitPeriod  duration `json:"rate-limit-period"`
+
+	DataportenGroupsURL      string   `json:"dataporten-groups-url"`
+	DataportenClientAdminURL string   `json:"dataporten-clientadmin-url"`
+	DataportenTimeout        duration `json:"dataporten-timeout"`
+	DataportenRetries        int      `json:"dataporten-retries"`
+	GroupCacheTTL            duration `json:"group-cache-ttl"`
+	GroupCacheSize           int      `json:"group-cache-size"`
+
+	IdentityProvider string `json:"identity-provider"`
+	OIDCIssuer       string `json:"oidc-issuer"`
+	OIDCAudience     string `json:"oidc-audience"`
+	OIDCJWKSURL      string `json:"oidc-jwks-url"`
+	OIDCUserIdClaim  string `json:"oidc-userid-claim"`
+	OIDCNameClaim    string `json:"oidc-name-claim"`
+	OIDCGroupsClaim  string `json:"oidc-groups-claim"`
+
+	NamespaceMapping         string     `json:"namespace-mapping"`
+	NamespaceMappingInterval duration   `json:"namespace-mapping-interval"`
+	NamespaceAnnotations     bool       `json:"namespace-annotations"`
+	AdminGroups              stringList `json:"admin-groups"`
+	SecretPaths              stringList `json:"secret-paths"`
+	SchemaDir                string     `json:"schema-dir"`
+	PolicyFile               string     `json:"policy"`
+	AuditLog                 string     `json:"audit-log"`
+
+	RepoMaxAge       duration `json:"repo-max-age"`
+	ReadyzTimeout    duration `json:"readyz-timeout"`
+	ReadyzDataporten bool     `json:"readyz-dataporten"`
+	TraceExporter    string   `json:"trace-exporter"`
+	TraceEndpoint    string   `json:"trace-endpoint"`
+	TraceSampleRatio float64  `json:"trace-sample-ratio"`
+	LogFormat        string   `json:"log-format"`
+	LogLevel         string   `json:"log-level"`
+
+	DemoCharts   string `json:"demo-charts"`
+	DemoUsers    string `json:"demo-users"`
+	DemoSubjects string `json:"demo-subjects"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:                     8080,
+		MetricsAddr:              ":9090",
+		ReadTimeout:              duration{30 * time.Second},
+		WriteTimeout:             duration{4 * time.Minute},
+		IdleTimeout:              duration{120 * time.Second},
+		RequestTimeout:           duration{60 * time.Second},
+		InstallTimeout:           duration{3 * time.Minute},
+		ShutdownTimeout:          duration{4 * time.Minute},
+		Mode:                     modeProduction,
+		CORSAllowedMethods:       stringList{"GET", "POST", "PATCH", "DELETE"},
+		CORSAllowedHeaders:       stringList(defaultCORSHeaders),
+		CORSMaxAge:               duration{5 * time.Minute},
+		RateLimitRead:            600,
+		RateLimitWrite:           30,
+		RateLimitAddress:         3000,
+		RateLimitPeriod:          duration{time.Minute},
+		DataportenGroupsURL:      dataporten.DefaultGroupsURL,
+		DataportenClientAdminURL: dataporten.DefaultClientAdminURL,
+		DataportenTimeout:        duration{dataporten.DefaultTimeout},
+		DataportenRetries:        dataporten.DefaultMaxRetries,
+		GroupCacheTTL:            duration{dataporten.DefaultGroupCacheTTL},
+		GroupCacheSize:           dataporten.DefaultGroupCacheSize,
+		IdentityProvider:         identityDataporten,
+		OIDCUserIdClaim:          "sub",
+		OIDCNameClaim:            "name",
+		OIDCGroupsClaim:          "groups",
+		NamespaceMapping:         defaultNamespaceMappingFile,
+		NamespaceMappingInterval: duration{10 * time.Second},
+		ReadyzTimeout:            duration{5 * time.Second},
+		TraceExporter:            tracing.ExporterNone,
+		TraceSampleRatio:         1,
+		LogFormat:                logger.FormatText,
+		LogLevel:                 "info",
+		DemoCharts:               "demo/charts",
+		DemoSubjects:             "demo/subjects.yml",
+	}
+}
+
+// The flags setting c, with the current values of c as defaults.
+func (c *Config) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("appstore-server", flag.ContinueOnError)
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "YAML file with the configuration, overridden by environment variables and flags. Defaults to $APPSTORE_CONFIG")
+	fs.BoolVar(&c.Debug, "debug", c.Debug, "Enable debug output")
+	fs.IntVar(&c.Port, "port", c.Port, "The port to use when hosting the server")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "Certificate served over TLS, along with -tls-key-file. Plain HTTP is served when empty. Defaults to $TLS_CERT_FILE")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "Private key of the TLS certificate. Defaults to $TLS_KEY_FILE")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "Address /metrics and /debug/vars are served on, apart from the API. Not served when empty")
+	fs.DurationVar(&c.ReadTimeout.Duration, "read-timeout", c.ReadTimeout.Duration, "How long reading a request, including its body, may take")
+	fs.DurationVar(&c.WriteTimeout.Duration, "write-timeout", c.WriteTimeout.Duration, "How long handling a request and writing the response may take, must be longer than -request-timeout and -install-timeout")
+	fs.DurationVar(&c.IdleTimeout.Duration, "idle-timeout", c.IdleTimeout.Duration, "How long idle keep-alive connections are kept open")
+	fs.DurationVar(&c.RequestTimeout.Duration, "request-timeout", c.RequestTimeout.Duration, "How long handlers of GET requests may take before the request is answered with 504")
+	fs.DurationVar(&c.InstallTimeout.Duration, "install-timeout", c.InstallTimeout.Duration, "How long handlers of other requests, such as installs and upgrades, may take before the request is answered with 504")
+	fs.DurationVar(&c.ShutdownTimeout.Duration, "shutdown-timeout", c.ShutdownTimeout.Duration, "How long to wait for requests in flight and background workers when shutting down")
+	fs.StringVar(&c.TillerHost, "host", c.TillerHost, "Address of tiller. Defaults to $HELM_HOST")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "Either production, or demo to run against an in-memory tiller and a fake dataporten")
+	fs.Var(&c.CORSAllowedOrigins, "cors-allowed-origins", "Comma separated origins allowed to make cross-origin requests, like https://example.com or https://*.example.com for its subdomains. None are allowed when empty. Defaults to $CORS_ALLOWED_ORIGINS")
+	fs.Var(&c.CORSAllowedMethods, "cors-allowed-methods", "Comma separated methods allowed in cross-origin requests")
+	fs.Var(&c.CORSAllowedHeaders, "cors-allowed-headers", "Comma separated headers allowed in cross-origin requests")
+	fs.BoolVar(&c.CORSAllowCredentials, "cors-allow-credentials", c.CORSAllowCredentials, "Allow cross-origin requests with cookies or HTTP authentication")
+	fs.DurationVar(&c.CORSMaxAge.Duration, "cors-max-age", c.CORSMaxAge.Duration, "How long browsers may cache the answers to preflight requests")
+	fs.IntVar(&c.RateLimitRead, "rate-limit-read", c.RateLimitRead, "How many GET requests each user, or address when not authenticated, may make per -rate-limit-period. Not limited when 0")
+	fs.IntVar(&c.RateLimitWrite, "rate-limit-write", c.RateLimitWrite, "How many POST, PATCH and DELETE requests each user may make per -rate-limit-period. Not limited when 0")
+	fs.IntVar(&c.RateLimitAddress, "rate-limit-address", c.RateLimitAddress, "How many GET, and how many other, requests each address may make per -rate-limit-period before the user is identified. Not limited when 0")
+	fs.DurationVar(&c.RateLimitPeriod.Duration, "rate-limit-period", c.RateLimitPeriod.Duration, "Period over which the requests are limited, the whole budget may be used at once")
+	fs.StringVar(&c.DataportenGroupsURL, "dataporten-groups-url", c.DataportenGroupsURL, "Base URL of the Dataporten groups API")
+	fs.StringVar(&c.DataportenClientAdminURL, "dataporten-clientadmin-url", c.DataportenClientAdminURL, "Base URL of the Dataporten clientadmin API")
+	fs.DurationVar(&c.DataportenTimeout.Duration, "dataporten-timeout", c.DataportenTimeout.Duration, "Timeout of requests to Dataporten")
+	fs.IntVar(&c.DataportenRetries, "dataporten-retries", c.DataportenRetries, "How many times idempotent requests to Dataporten are retried")
+	fs.DurationVar(&c.GroupCacheTTL.Duration, "group-cache-ttl", c.GroupCacheTTL.Duration, "How long the groups of a token are cached")
+	fs.IntVar(&c.GroupCacheSize, "group-cache-size", c.GroupCacheSize, "How many tokens to cache the groups of")
+	fs.StringVar(&c.IdentityProvider, "identity-provider", c.IdentityProvider, "How users are identified, either dataporten or oidc")
+	fs.StringVar(&c.OIDCIssuer, "oidc-issuer", c.OIDCIssuer, "Issuer of the tokens accepted by the oidc identity provider")
+	fs.StringVar(&c.OIDCAudience, "oidc-audience", c.OIDCAudience, "Expected audience of the tokens, usually the client id")
+	fs.StringVar(&c.OIDCJWKSURL, "oidc-jwks-url", c.OIDCJWKSURL, "URL of the keys used to verify tokens. Discovered from the issuer when empty")
+	fs.StringVar(&c.OIDCUserIdClaim, "oidc-userid-claim", c.OIDCUserIdClaim, "Claim containing the user id")
+	fs.StringVar(&c.OIDCNameClaim, "oidc-name-claim", c.OIDCNameClaim, "Claim containing the name of the user")
+	fs.StringVar(&c.OIDCGroupsClaim, "oidc-groups-claim", c.OIDCGroupsClaim, "Claim containing the groups of the user, nested claims are separated by dots")
+	fs.StringVar(&c.NamespaceMapping, "namespace-mapping", c.NamespaceMapping, "YAML file mapping namespaces to subjects, may be empty when using -namespace-annotations. Defaults to $NAMESPACE_MAPPING_FILE")
+	fs.DurationVar(&c.NamespaceMappingInterval.Duration, "namespace-mapping-interval", c.NamespaceMappingInterval.Duration, "How often the namespace mapping file is checked for changes")
+	fs.BoolVar(&c.NamespaceAnnotations, "namespace-annotations", c.NamespaceAnnotations, "Also map namespaces to subjects using the appstore annotations of the namespaces in the cluster")
+	fs.Var(&c.AdminGroups, "admin-groups", "Comma separated groups whose members may use the admin endpoints. Defaults to $ADMIN_GROUPS")
+	fs.Var(&c.SecretPaths, "secret-paths", "Comma separated paths of values masked in release responses, in addition to secrets.*, password, token and client_secret. Defaults to $SECRET_PATHS")
+	fs.StringVar(&c.SchemaDir, "schema-dir", c.SchemaDir, "Directory of <chart>[-<version>].schema.json files validating the values of charts without a values.schema.json. Defaults to $SCHEMA_DIR")
+	fs.StringVar(&c.PolicyFile, "policy", c.PolicyFile, "YAML file with the rules the manifests of releases must follow. Defaults to $POLICY_FILE")
+	fs.StringVar(&c.AuditLog, "audit-log", c.AuditLog, "File the audit log is appended to, as JSON lines. The audit log is only kept in memory when empty. Defaults to $AUDIT_LOG")
+	fs.DurationVar(&c.RepoMaxAge.Duration, "repo-max-age", c.RepoMaxAge.Duration, "How old the index of a repository with charts may be before the server is no longer ready. The indexes are only downloaded at startup, so the server must then be restarted. Not checked when 0")
+	fs.DurationVar(&c.ReadyzTimeout.Duration, "readyz-timeout", c.ReadyzTimeout.Duration, "How long each readiness check may take")
+	fs.BoolVar(&c.ReadyzDataporten, "readyz-dataporten", c.ReadyzDataporten, "Also check that Dataporten can be reached when checking readiness")
+	fs.StringVar(&c.TraceExporter, "trace-exporter", c.TraceExporter, "Where traces are exported to, one of none, stdout and otlp. Defaults to $TRACE_EXPORTER")
+	fs.StringVar(&c.TraceEndpoint, "trace-endpoint", c.TraceEndpoint, "File the stdout exporter appends to instead of stdout, or host:port of the OTLP/HTTP collector. Defaults to $TRACE_ENDPOINT")
+	fs.Float64Var(&c.TraceSampleRatio, "trace-sample-ratio", c.TraceSampleRatio, "Share of the requests traced, whatever the caller decided")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "Format of the log, either text or json. Defaults to $LOG_FORMAT")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Lowest level logged, one of debug, info, warning and error. Defaults to $LOG_LEVEL")
+	fs.StringVar(&c.DemoCharts, "demo-charts", c.DemoCharts, "Directory containing the charts available in demo mode")
+	fs.StringVar(&c.DemoUsers, "demo-users", c.DemoUsers, "YAML file containing the users and groups available in demo mode")
+	fs.StringVar(&c.DemoSubjects, "demo-subjects", c.DemoSubjects, "Namespace to subject mapping used in demo mode")
+
+	return fs
+}
+
+// Set the options that have environment variables from those that are
+// set.
+func (c *Config) applyEnv(getenv func(string) string) {
+	vars := map[string]*string{
+		helm_env.HostEnvVar:      &c.TillerHost,
+		"TLS_CERT_FILE":          &c.TLSCertFile,
+		"TLS_KEY_FILE":           &c.TLSKeyFile,
+		"NAMESPACE_MAPPING_FILE": &c.NamespaceMapping,
+		"SCHEMA_DIR":             &c.SchemaDir,
+		"POLICY_FILE":            &c.PolicyFile,
+		"AUDIT_LOG":              &c.AuditLog,
+		"TRACE_EXPORTER":         &c.TraceExporter,
+		"TRACE_ENDPOINT":         &c.TraceEndpoint,
+		"LOG_FORMAT":             &c.LogFormat,
+		"LOG_LEVEL":              &c.LogLevel,
+	}
+	for key, value := range vars {
+		if env := getenv(key); env != "" {
+			*value = env
+		}
+	}
+
+	lists := map[string]*stringList{
+		"ADMIN_GROUPS":         &c.AdminGroups,
+		"SECRET_PATHS":         &c.SecretPaths,
+		"CORS_ALLOWED_ORIGINS": &c.CORSAllowedOrigins,
+	}
+	for key, value := range lists {
+		if env := getenv(key); env != "" {
+			value.Set(env)
+		}
+	}
+}
+
+// Read the config file, rejecting unknown keys so that typos don't go
+// unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("%s is not valid YAML: %s", path, err.Error())
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("%s is not a valid config file: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+// Build the configuration from the command line arguments, the
+// environment and the config file they point to, and validate it.
+func loadConfig(args []string, getenv func(string) string) (*Config, error) {
+	// The flags are parsed once to find the config file, and again to
+	// override what it sets.
+	c := defaultConfig()
+	c.ConfigFile = getenv("APPSTORE_CONFIG")
+	if err := c.flagSet().Parse(args); err != nil {
+		return nil, err
+	}
+	path := c.ConfigFile
+
+	c = defaultConfig()
+	c.ConfigFile = path
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	c.applyEnv(getenv)
+	if err := c.flagSet().Parse(args); err != nil {
+		return nil, err
+	}
+
+	return c, c.Validate()
+}
+
+// Check that the configuration is complete and consistent.
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Port <= 0 || c.Port > 65535 {
+		problem("-port must be between 1 and 65535, not %d", c.Port)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problem("-tls-cert-file and -tls-key-file must be given together")
+	}
+	for name, d := range map[string]duration{
+		"-read-timeout":               c.ReadTimeout,
+		"-write-timeout":              c.WriteTimeout,
+		"-idle-timeout":               c.IdleTimeout,
+		"-request-timeout":            c.RequestTimeout,
+		"-install-timeout":            c.InstallTimeout,
+		"-shutdown-timeout":           c.ShutdownTimeout,
+		"-dataporten-timeout":         c.DataportenTimeout,
+		"-namespace-mapping-interval": c.NamespaceMappingInterval,
+		"-readyz-timeout":             c.ReadyzTimeout,
+		"-rate-limit-period":          c.RateLimitPeriod,
+	} {
+		if d.Duration <= 0 {
+			problem("%s must be positive", name)
+		}
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		if err := checkOrigin(origin); err != nil {
+			problem("-cors-allowed-origins: %s", err.Error())
+		}
+	}
+	if len(c.CORSAllowedMethods) == 0 {
+		problem("-cors-allowed-methods must not be empty")
+	}
+	if c.CORSMaxAge.Duration < 0 {
+		problem("-cors-max-age must not be negative")
+	}
+	if c.RateLimitRead < 0 || c.RateLimitWrite < 0 || c.RateLimitAddress < 0 {
+		problem("-rate-limit-read, -rate-limit-write and -rate-limit-address must not be negative")
+	}
+	if c.WriteTimeout.Duration <= c.RequestTimeout.Duration {
+		problem("-write-timeout (%s) must be longer than -request-timeout (%s)", c.WriteTimeout.Duration, c.RequestTimeout.Duration)
+	}
+	if c.WriteTimeout.Duration <= c.InstallTimeout.Duration {
+		problem("-write-timeout (%s) must be longer than -install-timeout (%s)", c.WriteTimeout.Duration, c.InstallTimeout.Duration)
+	}
+
+	switch c.Mode {
+	case modeProduction:
+		if c.TillerHost == "" {
+			problem("the Tiller host is missing, set -host or $%s", helm_env.HostEnvVar)
+		}
+	case modeDemo:
+		if c.NamespaceAnnotations {
+			problem("namespace annotations can not be used in demo mode")
+		}
+		if c.IdentityProvider == identityOIDC {
+			problem("the oidc identity provider is not supported in demo mode")
+		}
+	default:
+		problem("unknown mode %q", c.Mode)
+	}
+
+	switch c.IdentityProvider {
+	case identityDataporten:
+	case identityOIDC:
+		if c.OIDCIssuer == "" {
+			problem("-oidc-issuer is missing")
+		}
+		if c.OIDCAudience == "" {
+			problem("-oidc-audience is missing")
+		}
+	default:
+		problem("unknown identity provider %q", c.IdentityProvider)
+	}
+	if c.NamespaceMapping == "" && !c.NamespaceAnnotations && c.Mode != modeDemo {
+		problem("no namespace mapping source, set -namespace-mapping or -namespace-annotations")
+	}
+
+	switch c.LogFormat {
+	case logger.FormatText, logger.FormatJSON:
+	default:
+		problem("unknown log format %q", c.LogFormat)
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		problem("%s", err.Error())
+	}
+	switch c.TraceExporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		problem("unknown trace exporter %q", c.TraceExporter)
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		problem("-trace-sample-ratio must be between 0 and 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "appstore-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 9090
+host: tiller-from-file:44134
+log-level: debug
+write-timeout: 5m
+admin-groups: [fc:org:a, fc:org:b]
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	env := map[string]string{
+		"APPSTORE_CONFIG": path,
+		"HELM_HOST":       "tiller-from-env:44134",
+		"LOG_LEVEL":       "warning",
+	}
+	c, err := loadConfig([]string{"-log-level", "error"}, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Port != 9090 {
+		t.Errorf("the port of the config file was not used: %d", c.Port)
+	}
+	if c.WriteTimeout.Duration != 5*time.Minute {
+		t.Errorf("the write timeout of the config file was not used: %s", c.WriteTimeout.Duration)
+	}
+	if c.ReadTimeout.Duration != 30*time.Second {
+		t.Errorf("the default read timeout was not kept: %s", c.ReadTimeout.Duration)
+	}
+	if strings.Join(c.AdminGroups, ",") != "fc:org:a,fc:org:b" {
+		t.Errorf("unexpected admin groups: %v", c.AdminGroups)
+	}
+	if c.TillerHost != "tiller-from-env:44134" {
+		t.Errorf("the environment did not override the config file: %s", c.TillerHost)
+	}
+	if c.LogLevel != "error" {
+		t.Errorf("the flags did not override the environment: %s", c.LogLevel)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	env := map[string]string{"HELM_HOST": "tiller:44134"}
+	getenv := func(key string) string { return env[key] }
+
+	args := []string{"-tls-cert-file", "cert.pem", "-request-timeout", "5m", "-identity-provider", "oidc", "-oidc-issuer", "https://keycloak.example.org"}
+	_, err := loadConfig(args, getenv)
+	if err == nil {
+		t.Fatal("the invalid configuration was accepted")
+	}
+	for _, problem := range []string{"-tls-key-file", "-write-timeout", "-oidc-audience"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%s was not reported: %s", problem, err.Error())
+		}
+	}
+
+	path := writeConfigFile(t, "prot: 9090\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	if _, err := loadConfig([]string{"-config", path}, getenv); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("the unknown key was not rejected: %v", err)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for origin, valid := range map[string]bool{
+		"*":                           true,
+		"https://appstore.uninett.no": true,
+		"https://*.uninett.no":        true,
+		"http://localhost:3000":       true,
+		"appstore.uninett.no":         false,
+		"https://uninett.no/":         false,
+		"https://app.*.uninett.no":    false,
+		"ftp://uninett.no":            false,
+	} {
+		if err := checkOrigin(origin); (err == nil) != valid {
+			t.Errorf("unexpected result of checking %s: %v", origin, err)
+		}
+	}
+}
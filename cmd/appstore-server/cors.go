@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/goware/cors"
+)
+
+// The headers of the requests made by the frontend.
+var defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Dataporten-Token", "X-Dataporten-Clientid", "X-Dataporten-Userid", "X-Dataporten-Userid-sec", "X-forwarded-for", "X-forwarded-proto"}
+
+// Check that origin is either *, an origin like https://example.com, or
+// one with a wildcard subdomain like https://*.example.com.
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("%q is not an origin like https://example.com", origin)
+	}
+	if host := strings.TrimPrefix(u.Host, "*."); strings.Contains(host, "*") {
+		return fmt.Errorf("%q may only have a wildcard as its first label, like https://*.example.com", origin)
+	}
+
+	return nil
+}
+
+// The middleware answering the preflight requests of browsers and
+// allowing the configured origins to read the responses. No cross-origin
+// requests are allowed when no origins are configured.
+func corsMiddleware(c *Config) func(http.Handler) http.Handler {
+	if len(c.CORSAllowedOrigins) == 0 {
+		log.Info("No -cors-allowed-origins given, cross-origin requests are not allowed")
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if c.CORSAllowCredentials && strings.Contains(origin, "*") {
+			log.Warnf("The wildcard origin %s is allowed to make requests with credentials, any site matching it can act on behalf of the users", origin)
+		}
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins:   c.CORSAllowedOrigins,
+		AllowedMethods:   c.CORSAllowedMethods,
+		AllowedHeaders:   c.CORSAllowedHeaders,
+		AllowCredentials: c.CORSAllowCredentials,
+		MaxAge:           int(c.CORSMaxAge.Seconds()),
+	}).Handler
+}
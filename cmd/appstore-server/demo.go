@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/demo"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// Set up the demo mode: an in-memory tiller, a helm home with the
+// fixture charts and a fake Dataporten with the configured users.
+// Returns the middleware used to authenticate the fake users, and a
+// client for the fake Dataporten.
+func setupDemo(settings *helm_env.EnvSettings, chartsDir string, usersFile string) (func(next http.Handler) http.Handler, *dataporten.Client, error) {
+	logger := log.WithFields(log.Fields{"namespace": "demo"})
+
+	home, err := demo.SetupHelmHome(chartsDir, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings.Home = home
+
+	tillerHost, err := demo.NewTiller(logger).Serve()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings.TillerHost = tillerHost
+
+	users, err := demo.LoadUsers(usersFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	fakeDataporten := dataporten.NewFakeServer(users)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		logger.Error(http.Serve(lis, fakeDataporten))
+	}()
+	baseURL := "http://" + lis.Addr().String()
+
+	logger.Debug("Helm home: ", home)
+	logger.Debug("Fake dataporten: ", baseURL)
+	for _, u := range users {
+		logger.Debugf("User %s (%s) has token %s", u.Name, u.UserId, u.Token)
+	}
+
+	return fakeDataporten.AuthMiddleware, dataporten.NewFakeClient(baseURL), nil
+}
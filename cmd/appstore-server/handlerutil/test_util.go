@@ -19,9 +19,12 @@ func TestHandler(t *testing.T, h http.Handler, method, path string, body io.Read
 	return w.Result(), w.Body
 }
 
+// Check that the handler answered with wantedStatus. The status of the
+// response is compared, rather than assuming 200 OK was wanted.
 func CheckStatus(resp *http.Response, wantedStatus int, t *testing.T) {
-	if status := wantedStatus; status != http.StatusOK {
+	t.Helper()
+	if status := resp.StatusCode; status != wantedStatus {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
+			status, wantedStatus)
 	}
 }
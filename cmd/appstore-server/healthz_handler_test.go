@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/UNINETT/appstore/cmd/appstore-server/handlerutil"
+	"github.com/UNINETT/appstore/pkg/readiness"
 )
 
 func TestHealthzHandler(t *testing.T) {
@@ -26,3 +30,20 @@ func TestHealthzHandler(t *testing.T) {
 			returnedHi.Pid, expectedPid)
 	}
 }
+
+func TestReadyzHandler(t *testing.T) {
+	checks := []readiness.Check{
+		{Name: "tiller", Run: func(ctx context.Context) error { return fmt.Errorf("unreachable") }},
+	}
+	resp, body := handlerutil.TestHandler(t, makeReadyzHandler(checks, time.Second), "GET", "/readyz", nil)
+
+	handlerutil.CheckStatus(resp, http.StatusServiceUnavailable, t)
+
+	var report readiness.Report
+	if err := json.NewDecoder(body).Decode(&report); err != nil {
+		t.Fatalf("handler returned invalid JSON!")
+	}
+	if report.Ready || len(report.Checks) != 1 || report.Checks[0].Error != "unreachable" {
+		t.Errorf("handler returned an unexpected report: %+v", report)
+	}
+}
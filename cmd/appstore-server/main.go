@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"net/http"
@@ -8,85 +10,211 @@ import (
 	"time"
 
 	"github.com/UNINETT/appstore/cmd/appstore-server/api"
+	"github.com/UNINETT/appstore/pkg/audit"
+	"github.com/UNINETT/appstore/pkg/dataporten"
 	"github.com/UNINETT/appstore/pkg/helmutil"
+	"github.com/UNINETT/appstore/pkg/identity"
 	"github.com/UNINETT/appstore/pkg/logger"
+	"github.com/UNINETT/appstore/pkg/metrics"
+	"github.com/UNINETT/appstore/pkg/policy"
+	"github.com/UNINETT/appstore/pkg/ratelimit"
+	"github.com/UNINETT/appstore/pkg/schema"
+	"github.com/UNINETT/appstore/pkg/tracing"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/goware/cors"
 
 	log "github.com/Sirupsen/logrus"
 
 	auth "scm.uninett.no/laas/laasctl-auth"
-
-	helm_env "k8s.io/helm/pkg/helm/environment"
 )
 
 var startTime time.Time
 
 const version string = "v1"
 
-func main() {
-	debug := flag.Bool("debug", false, "Enable debug output")
-	port := flag.Int("port", 8080, "The port to use when hosting the server")
-	tillerHost := flag.String("host", os.Getenv(helm_env.HostEnvVar), "Address of tiller. Defaults to $HELM_HOST")
-	flag.Parse()
+const (
+	modeProduction = "production"
+	modeDemo       = "demo"
+
+	identityDataporten = "dataporten"
+	identityOIDC       = "oidc"
 
-	settings := helmutil.InitHelmSettings(*debug, *tillerHost)
+	defaultNamespaceMappingFile = "./subjects.yml"
+	// How many audit events are kept without an audit log file.
+	memoryAuditEvents = 1000
+)
 
-	if settings.TillerHost == "" {
-		panic(fmt.Errorf("Tiller host is missing!"))
+func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
 	}
 
-	if err := helmutil.EnsureDirectories(settings.Home); err != nil {
+	log.SetOutput(os.Stderr)
+	if err := logger.Configure(cfg.LogFormat, cfg.LogLevel); err != nil {
 		panic(err)
 	}
-	if err := helmutil.EnsureDefaultRepos(settings.Home, settings, false); err != nil {
+	shutdownTracing, err := tracing.Setup(cfg.TraceExporter, cfg.TraceEndpoint, cfg.TraceSampleRatio)
+	if err != nil {
 		panic(err)
 	}
-	if err := helmutil.EnsureRepoFileFormat(settings.Home.RepositoryFile()); err != nil {
-		panic(err)
+
+	settings := helmutil.InitHelmSettings(cfg.Debug, cfg.TillerHost)
+	apiOpts := &api.Options{Settings: settings}
+
+	switch cfg.Mode {
+	case modeProduction:
+		if err := helmutil.EnsureDirectories(settings.Home); err != nil {
+			panic(err)
+		}
+		if err := helmutil.EnsureDefaultRepos(settings.Home, settings, false); err != nil {
+			panic(err)
+		}
+		if err := helmutil.EnsureRepoFileFormat(settings.Home.RepositoryFile()); err != nil {
+			panic(err)
+		}
+
+		auth.SetConfig(
+			[]string{"dataporten"},
+			nil,
+			map[string]string{"dataporten_creds": os.Getenv("DATAPORTEN_GK_CREDS")},
+			os.Getenv("DATAPORTEN_GROUPS_ENDPOINT_URL"),
+			"",
+			"",
+		)
+		apiOpts.AuthMiddleware = auth.MiddlewareHandler
+
+		dp := dataporten.NewClient(log.WithFields(log.Fields{"namespace": "dataporten"}))
+		dp.GroupsURL = cfg.DataportenGroupsURL
+		dp.ClientAdminURL = cfg.DataportenClientAdminURL
+		dp.Timeout = cfg.DataportenTimeout.Duration
+		dp.MaxRetries = cfg.DataportenRetries
+		apiOpts.Dataporten = dp
+	case modeDemo:
+		authMiddleware, dp, err := setupDemo(settings, cfg.DemoCharts, cfg.DemoUsers)
+		if err != nil {
+			panic(err)
+		}
+		apiOpts.AuthMiddleware = authMiddleware
+		apiOpts.Dataporten = dp
+		cfg.NamespaceMapping = cfg.DemoSubjects
 	}
 
-	auth.SetConfig(
-		[]string{"dataporten"},
-		nil,
-		map[string]string{"dataporten_creds": os.Getenv("DATAPORTEN_GK_CREDS")},
-		os.Getenv("DATAPORTEN_GROUPS_ENDPOINT_URL"),
-		"",
-		"",
-	)
+	bg := newWorkers()
+	namespaceMappings, err := setupNamespaceMappings(cfg.NamespaceMapping, cfg.NamespaceMappingInterval.Duration, cfg.NamespaceAnnotations, bg)
+	if err != nil {
+		panic(err)
+	}
+	apiOpts.NamespaceMappings = namespaceMappings
+	apiOpts.AdminGroups = cfg.AdminGroups
+	apiOpts.Schemas = schema.NewRegistry(cfg.SchemaDir)
+	if cfg.AuditLog != "" {
+		apiOpts.Audit, err = audit.NewFileSink(cfg.AuditLog)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		log.Warn("No -audit-log given, the audit log is only kept in memory")
+		apiOpts.Audit = audit.NewMemorySink(memoryAuditEvents)
+	}
+	if cfg.PolicyFile != "" {
+		apiOpts.Policy, err = policy.Load(cfg.PolicyFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+	apiOpts.SecretPaths = cfg.SecretPaths
+	apiOpts.RateLimiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: cfg.RateLimitRead, Per: cfg.RateLimitPeriod.Duration},
+		ratelimit.Limit{Requests: cfg.RateLimitWrite, Per: cfg.RateLimitPeriod.Duration})
+	addressLimit := ratelimit.Limit{Requests: cfg.RateLimitAddress, Per: cfg.RateLimitPeriod.Duration}
+	apiOpts.AddressRateLimiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), addressLimit, addressLimit)
+
+	switch cfg.IdentityProvider {
+	case identityDataporten:
+		groupCache := dataporten.NewGroupCache(apiOpts.Dataporten, cfg.GroupCacheTTL.Duration, cfg.GroupCacheSize)
+		apiOpts.IdentityProvider = identity.NewDataportenProvider(groupCache)
+	case identityOIDC:
+		// The tokens are verified by the identity provider itself, and
+		// are not accepted by Dataporten, so no clients are created.
+		apiOpts.AuthMiddleware = nil
+		apiOpts.Dataporten = nil
+		apiOpts.IdentityProvider = identity.NewOIDCProvider(identity.OIDCConfig{
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			JWKSURL:     cfg.OIDCJWKSURL,
+			UserIdClaim: cfg.OIDCUserIdClaim,
+			NameClaim:   cfg.OIDCNameClaim,
+			GroupsClaim: cfg.OIDCGroupsClaim,
+		})
+	}
 
 	baseRouter := chi.NewRouter()
 
 	baseRouter.Use(middleware.RequestID)
 	baseRouter.Use(middleware.RealIP)
 	baseRouter.Use(logger.RequestLogger)
+	baseRouter.Use(tracing.Middleware)
 	baseRouter.Use(middleware.Recoverer)
 	baseRouter.Use(middleware.CloseNotify)
-	baseRouter.Use(middleware.Timeout(60 * time.Second))
-
-	cors := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Dataporten-Token", "X-Dataporten-Clientid", "X-Dataporten-Userid", "X-Dataporten-Userid-sec", "X-forwarded-for", "X-forwarded-proto"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})
-	baseRouter.Use(cors.Handler)
-
-	baseRouter.Mount("/api", api.CreateAPIRouter(settings))
+	baseRouter.Use(timeoutMiddleware(cfg))
+
+	baseRouter.Use(corsMiddleware(cfg))
+
+	baseRouter.Mount("/api", api.CreateAPIRouter(apiOpts))
 	baseRouter.Get("/healthz", healthzHandler)
+	var probedDataporten *dataporten.Client
+	if cfg.ReadyzDataporten {
+		probedDataporten = apiOpts.Dataporten
+	}
+	baseRouter.Get("/readyz", makeReadyzHandler(readinessChecks(settings, cfg.RepoMaxAge.Duration, namespaceMappings, probedDataporten), cfg.ReadyzTimeout.Duration))
+
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      baseRouter,
+		ReadTimeout:  cfg.ReadTimeout.Duration,
+		WriteTimeout: cfg.WriteTimeout.Duration,
+		IdleTimeout:  cfg.IdleTimeout.Duration,
+	}
 
-	customFormatter := new(log.TextFormatter)
-	customFormatter.TimestampFormat = "2006-01-02 15:04:05"
-	customFormatter.FullTimestamp = true
-	log.SetFormatter(customFormatter)
+	// The metrics are served apart from the API, so that they can be kept
+	// from the public.
+	var internal *http.Server
+	if cfg.MetricsAddr != "" {
+		internalRouter := chi.NewRouter()
+		internalRouter.Handle("/debug/vars", expvar.Handler())
+		internalRouter.Handle("/metrics", metrics.Handler())
+		internal = &http.Server{
+			Addr:         cfg.MetricsAddr,
+			Handler:      internalRouter,
+			ReadTimeout:  cfg.ReadTimeout.Duration,
+			WriteTimeout: cfg.WriteTimeout.Duration,
+			IdleTimeout:  cfg.IdleTimeout.Duration,
+		}
+	}
 
-	log.SetLevel(log.DebugLevel)
-	log.SetOutput(os.Stderr)
-	log.Debug("Starting server on port ", *port)
+	log.Debug("Starting server on port ", cfg.Port)
+	log.Debug("Metrics address: ", cfg.MetricsAddr)
+	log.Debug("Config file: ", cfg.ConfigFile)
+	log.Debug("Mode: ", cfg.Mode)
+	log.Debug("TLS: ", cfg.TLSCertFile != "")
+	log.Debug("Identity provider: ", cfg.IdentityProvider)
 	log.Debug("Tiller host: ", settings.TillerHost)
+	log.Debugf("Namespace mapping: %s (version %s)", namespaceMappings.Version().Source, namespaceMappings.Version().Version)
 	startTime = time.Now()
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), baseRouter))
+	err = serve(server, internal, cfg, bg)
+
+	if sink, ok := apiOpts.Audit.(*audit.FileSink); ok {
+		sink.Close()
+	}
+	shutdownTracing(context.Background())
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	log.Info("Stopped")
 }
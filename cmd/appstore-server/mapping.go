@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/kubemapping"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Set up the sources of the namespace mapping: the mapping file, unless
+// mappingFile is empty, and the annotations of the namespaces in the
+// cluster when fromAnnotations is set. The mappings of both sources are
+// merged. The watches are run by bg.
+func setupNamespaceMappings(mappingFile string, interval time.Duration, fromAnnotations bool, bg *workers) (config.MappingSource, error) {
+	logger := log.WithFields(log.Fields{"namespace": "config"})
+	var sources []config.MappingSource
+
+	if mappingFile != "" {
+		store, err := config.NewNamespaceMappingStore(mappingFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		bg.Go(func(stop <-chan struct{}) {
+			store.Watch(interval, stop)
+		})
+		sources = append(sources, store)
+	}
+
+	if fromAnnotations {
+		kubeConfig, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+		client, err := kubernetes.NewForConfig(kubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		source := kubemapping.NewSource(client, 10*time.Minute, logger)
+		bg.Go(source.Run)
+		if !source.WaitForSync(bg.stop) {
+			return nil, fmt.Errorf("could not list the namespaces in the cluster")
+		}
+		sources = append(sources, source)
+	}
+
+	switch len(sources) {
+	case 0:
+		return nil, fmt.Errorf("no namespace mapping source is configured")
+	case 1:
+		return sources[0], nil
+	}
+	return config.NewMergedMappingSource(sources...), nil
+}
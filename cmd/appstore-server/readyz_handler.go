@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/dataporten"
+	"github.com/UNINETT/appstore/pkg/helmutil"
+	"github.com/UNINETT/appstore/pkg/readiness"
+
+	helm_env "k8s.io/helm/pkg/helm/environment"
+)
+
+// The checks of /readyz. Dataporten is only probed when dp is not nil.
+func readinessChecks(settings *helm_env.EnvSettings, repoMaxAge time.Duration, namespaceMappings config.MappingSource, dp *dataporten.Client) []readiness.Check {
+	checks := []readiness.Check{
+		{Name: "tiller", Run: func(ctx context.Context) error {
+			_, err := helmutil.InitHelmClient(ctx, settings).GetVersion()
+			return err
+		}},
+		{Name: "repositories", Run: func(ctx context.Context) error {
+			return helmutil.CheckRepos(settings, repoMaxAge)
+		}},
+		{Name: "namespace_mapping", Run: func(ctx context.Context) error {
+			mappings := namespaceMappings.Mappings()
+			if len(mappings) == 0 {
+				return fmt.Errorf("no namespaces are mapped")
+			}
+			return config.ValidateNamespaceMappings(mappings)
+		}},
+	}
+	if dp != nil {
+		checks = append(checks, readiness.Check{Name: "dataporten", Run: dp.Ping})
+	}
+
+	return checks
+}
+
+func makeReadyzHandler(checks []readiness.Check, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readiness.Run(r.Context(), checks, timeout)
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.Encode(report)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/UNINETT/appstore/pkg/ratelimit"
+)
+
+// Answer GET requests taking longer than -request-timeout with 504.
+// Other requests, such as installs, which wait for Tiller, may take
+// -install-timeout instead.
+func timeoutMiddleware(c *Config) func(next http.Handler) http.Handler {
+	readTimeout := middleware.Timeout(c.RequestTimeout.Duration)
+	writeTimeout := middleware.Timeout(c.InstallTimeout.Duration)
+	return func(next http.Handler) http.Handler {
+		reads, writes := readTimeout(next), writeTimeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ratelimit.Budget(r.Method) == ratelimit.BudgetRead {
+				reads.ServeHTTP(w, r)
+			} else {
+				writes.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// Goroutines running in the background until the server shuts down,
+// such as the watch of the namespace mapping.
+type workers struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	return &workers{stop: make(chan struct{})}
+}
+
+// Run f in the background. f must return once stop is closed.
+func (w *workers) Go(f func(stop <-chan struct{})) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		f(w.stop)
+	}()
+}
+
+// Tell the workers to stop, and wait until they have or ctx is done.
+func (w *workers) Stop(ctx context.Context) error {
+	close(w.stop)
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the background workers did not stop: %s", ctx.Err().Error())
+	}
+}
+
+// Serve requests until SIGTERM or SIGINT is received, then stop
+// accepting requests and wait for those in flight, such as installs, and
+// the background workers to finish. TLS is used when a certificate is
+// configured. The internal server, serving the metrics, is optional and
+// always uses plain HTTP.
+func serve(server *http.Server, internal *http.Server, c *Config, bg *workers) error {
+	errs := make(chan error, 2)
+	go func() {
+		if c.TLSCertFile != "" {
+			errs <- server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	if internal != nil {
+		go func() {
+			errs <- internal.ListenAndServe()
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Infof("Received %s, waiting up to %s for requests in flight", sig, c.ShutdownTimeout.Duration)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.ShutdownTimeout.Duration)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if internal != nil {
+		internal.Shutdown(ctx)
+	}
+	// The workers are told to stop even when requests are still in
+	// flight, though they are not waited for then.
+	stopErr := bg.Stop(ctx)
+	if err != nil {
+		return fmt.Errorf("requests were still in flight: %s", err.Error())
+	}
+
+	return stopErr
+}
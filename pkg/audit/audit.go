@@ -0,0 +1,109 @@
+// Package audit records who changed which releases, and how, in an
+// append-only log.
+package audit
+
+import (
+	"net/http"
+	"time"
+)
+
+// What was done.
+const (
+	ActionInstall       = "install"
+	ActionUpgrade       = "upgrade"
+	ActionDelete        = "delete"
+	ActionRevealSecrets = "reveal_secrets"
+	ActionCreateClient  = "dataporten_client_create"
+	ActionDeleteClient  = "dataporten_client_delete"
+)
+
+// How it went.
+const (
+	OutcomeSuccess = "success"
+	// The user was not allowed to do it.
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Namespace string    `json:"namespace,omitempty"`
+	Release   string    `json:"release,omitempty"`
+	Package   string    `json:"package,omitempty"`
+	// The chart version of the release, and the version it had before
+	// an upgrade.
+	Version         string `json:"version,omitempty"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// The Dataporten client created or deleted.
+	Client string `json:"client,omitempty"`
+	// The changes to the values of the release, with secrets masked.
+	Diff    []Change `json:"diff,omitempty"`
+	Outcome string   `json:"outcome"`
+	Status  int      `json:"status"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Set the outcome of the event from the response to the request.
+func (e *Event) Finish(status int, err error) {
+	e.Status = status
+	switch {
+	case err == nil:
+		e.Outcome = OutcomeSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Outcome = OutcomeDenied
+	default:
+		e.Outcome = OutcomeFailure
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Which events to return from a query. Empty fields match every event.
+type Filter struct {
+	User      string
+	Action    string
+	Namespace string
+	Release   string
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+	// The maximum number of events, the newest first.
+	Limit int
+}
+
+func (f *Filter) Matches(e *Event) bool {
+	return (f.User == "" || f.User == e.User) &&
+		(f.Action == "" || f.Action == e.Action) &&
+		(f.Namespace == "" || f.Namespace == e.Namespace) &&
+		(f.Release == "" || f.Release == e.Release) &&
+		(f.Outcome == "" || f.Outcome == e.Outcome) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Where events are kept. Sinks only append events.
+type Sink interface {
+	Record(e *Event) error
+	// The events matching the filter, the newest first.
+	Query(f *Filter) ([]*Event, error)
+}
+
+// Select the newest events matching the filter from events, which are
+// in the order they were recorded.
+func selectEvents(events []*Event, f *Filter) []*Event {
+	selected := make([]*Event, 0)
+	for i := len(events) - 1; i >= 0; i-- {
+		if f.Limit > 0 && len(selected) >= f.Limit {
+			break
+		}
+		if f.Matches(events[i]) {
+			selected = append(selected, events[i])
+		}
+	}
+
+	return selected
+}
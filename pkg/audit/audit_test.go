@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := map[string]interface{}{
+		"image":   "jupyter/minimal-notebook:1.0",
+		"ingress": map[string]interface{}{"host": "a.example.org"},
+		"secrets": map[string]interface{}{"api": "old"},
+		"debug":   true,
+	}
+	new := map[string]interface{}{
+		"image":    "jupyter/minimal-notebook:1.1",
+		"ingress":  map[string]interface{}{"host": "a.example.org"},
+		"secrets":  map[string]interface{}{"api": "new"},
+		"replicas": 2,
+	}
+	mask := func(path []string) (string, bool) { return "********", path[0] == "secrets" }
+
+	expected := []Change{
+		{Path: "debug", Old: true},
+		{Path: "image", Old: "jupyter/minimal-notebook:1.0", New: "jupyter/minimal-notebook:1.1"},
+		{Path: "replicas", New: 2},
+		{Path: "secrets.api", Old: "********", New: "********"},
+	}
+	if changes := Diff(old, new, mask); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestDiffMasksNestedSecrets(t *testing.T) {
+	mask := func(path []string) (string, bool) { return "********", path[len(path)-1] == "password" }
+
+	// A scalar replaced by a map containing a secret.
+	changes := Diff(map[string]interface{}{"auth": "none"}, map[string]interface{}{"auth": map[string]interface{}{"user": "a", "password": "secret"}}, mask)
+	expected := []Change{{Path: "auth", Old: "none", New: map[string]interface{}{"user": "a", "password": "********"}}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	// A changed list containing secrets.
+	changes = Diff(
+		map[string]interface{}{"users": []interface{}{map[string]interface{}{"name": "a", "password": "old"}}},
+		map[string]interface{}{"users": []interface{}{map[string]interface{}{"name": "a", "password": "new"}, "b"}},
+		mask)
+	expected = []Change{{
+		Path: "users",
+		Old:  []interface{}{map[string]interface{}{"name": "a", "password": "********"}},
+		New:  []interface{}{map[string]interface{}{"name": "a", "password": "********"}, "b"},
+	}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileSink(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	start := time.Now()
+	for i, user := range []string{"alice", "bob", "alice"} {
+		e := &Event{Time: start.Add(time.Duration(i) * time.Second), User: user, Action: ActionInstall}
+		e.Finish(200, nil)
+		if err := s.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := s.Query(&Filter{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[0].Time.After(events[1].Time) {
+		t.Errorf("unexpected events: %v", events)
+	}
+	events, _ = s.Query(&Filter{Since: start.Add(time.Second), Limit: 1})
+	if len(events) != 1 || events[0].User != "alice" || events[0].Outcome != OutcomeSuccess {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
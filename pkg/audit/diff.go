@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A changed value.
+type Change struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// The changes from the values old to the values new, down to the
+// changed leaves. The old and new values at paths for which mask
+// returns a replacement are replaced with it, e.g. to hide secrets, also
+// within changed maps and lists. Lists don't add to the path.
+func Diff(old, new map[string]interface{}, mask func(path []string) (string, bool)) []Change {
+	var changes []Change
+	diffMaps(nil, old, new, mask, &changes)
+
+	return changes
+}
+
+func diffMaps(path []string, old, new map[string]interface{}, mask func([]string) (string, bool), changes *[]Change) {
+	keys := make(map[string]bool)
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		keyPath := append(append([]string{}, path...), k)
+		oldValue, inOld := old[k]
+		newValue, inNew := new[k]
+		oldMap, oldIsMap := oldValue.(map[string]interface{})
+		newMap, newIsMap := newValue.(map[string]interface{})
+		switch {
+		case oldIsMap && newIsMap:
+			diffMaps(keyPath, oldMap, newMap, mask, changes)
+		case oldIsMap && !inNew:
+			diffMaps(keyPath, oldMap, nil, mask, changes)
+		case newIsMap && !inOld:
+			diffMaps(keyPath, nil, newMap, mask, changes)
+		case !reflect.DeepEqual(oldValue, newValue) || inOld != inNew:
+			if inOld {
+				oldValue = maskValue(keyPath, oldValue, mask)
+			}
+			if inNew {
+				newValue = maskValue(keyPath, newValue, mask)
+			}
+			*changes = append(*changes, Change{Path: strings.Join(keyPath, "."), Old: oldValue, New: newValue})
+		}
+	}
+}
+
+// Return a copy of the value at path, with it or the values below it
+// replaced where mask says so.
+func maskValue(path []string, v interface{}, mask func([]string) (string, bool)) interface{} {
+	if replacement, masked := mask(path); masked {
+		return replacement
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			c[k] = maskValue(append(append([]string{}, path...), k), nested, mask)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, nested := range v {
+			c[i] = maskValue(path, nested, mask)
+		}
+		return c
+	}
+
+	return v
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSink{path: path, file: f}, nil
+}
+
+func (s *FileSink) Record(e *Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// Read the events in the file. Lines which are not events, e.g. a line
+// cut off by a crash, are skipped.
+func (s *FileSink) Query(filter *Filter) ([]*Event, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []*Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		e := new(Event)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			continue
+		}
+		if filter.Matches(e) {
+			events = append(events, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return selectEvents(events, filter), nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// MemorySink keeps the latest events in memory, e.g. in demo mode.
+type MemorySink struct {
+	max    int
+	mu     sync.RWMutex
+	events []*Event
+}
+
+// A sink keeping at most max events.
+func NewMemorySink(max int) *MemorySink {
+	return &MemorySink{max: max}
+}
+
+func (s *MemorySink) Record(e *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	if len(s.events) > s.max {
+		s.events = s.events[len(s.events)-s.max:]
+	}
+
+	return nil
+}
+
+func (s *MemorySink) Query(filter *Filter) ([]*Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return selectEvents(s.events, filter), nil
+}
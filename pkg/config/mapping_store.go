@@ -0,0 +1,147 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Provides the current namespace mapping.
+type MappingSource interface {
+	Mappings() []*NamespaceMapping
+	Version() MappingVersion
+}
+
+// The namespace mapping currently in use, and where it came from.
+type MappingVersion struct {
+	// The kind of source, e.g. file or kubernetes.
+	Source string `json:"source"`
+	Path   string `json:"path,omitempty"`
+	// Hash of what the mapping was built from.
+	Version    string    `json:"version"`
+	LoadedAt   time.Time `json:"loaded_at"`
+	Namespaces int       `json:"namespaces"`
+	// Why the last attempt to reload the mapping failed, if it did.
+	LastError string `json:"last_error,omitempty"`
+	// The versions of the sources a merged mapping was built from.
+	Sources []MappingVersion `json:"sources,omitempty"`
+}
+
+// NamespaceMappingStore holds the namespace mapping loaded from a file,
+// and replaces it when the file changes. An invalid file never replaces
+// a valid mapping.
+type NamespaceMappingStore struct {
+	path   string
+	logger *logrus.Entry
+
+	mu       sync.RWMutex
+	mappings []*NamespaceMapping
+	version  MappingVersion
+}
+
+func hashMapping(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Load the mapping in yamlFilepath. Fails if the file can't be read or
+// is invalid.
+func NewNamespaceMappingStore(yamlFilepath string, logger *logrus.Entry) (*NamespaceMappingStore, error) {
+	path, err := filepath.Abs(yamlFilepath)
+	if err != nil {
+		return nil, err
+	}
+	s := &NamespaceMappingStore{path: path, logger: logger}
+	if _, err := s.Reload(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return s, nil
+}
+
+// Create a store holding a fixed mapping, which is never reloaded.
+func NewStaticNamespaceMappingStore(mappings []*NamespaceMapping) *NamespaceMappingStore {
+	return &NamespaceMappingStore{
+		mappings: mappings,
+		version:  MappingVersion{Source: "static", LoadedAt: time.Now(), Namespaces: len(mappings)},
+	}
+}
+
+func (s *NamespaceMappingStore) Mappings() []*NamespaceMapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.mappings
+}
+
+func (s *NamespaceMappingStore) Version() MappingVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.version
+}
+
+// Read the file again, and replace the mapping if the file has changed
+// and is valid. Returns whether the mapping was replaced.
+func (s *NamespaceMappingStore) Reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil && s.mappings != nil && hashMapping(data) == s.version.Version {
+		s.version.LastError = ""
+		return false, nil
+	}
+
+	var mappings []*NamespaceMapping
+	if err == nil {
+		mappings, err = ParseNamespaceMappings(data)
+	}
+	if err != nil {
+		s.version.LastError = err.Error()
+		return false, err
+	}
+	s.mappings = mappings
+	s.version = MappingVersion{
+		Source:     "file",
+		Path:       s.path,
+		Version:    hashMapping(data),
+		LoadedAt:   time.Now(),
+		Namespaces: len(mappings),
+	}
+
+	return true, nil
+}
+
+// Check the file for changes every interval until stop is closed.
+func (s *NamespaceMappingStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := s.Reload()
+		if err != nil {
+			s.logger.Errorf("Keeping the current namespace mapping, reloading %s failed: %s", s.path, err.Error())
+			continue
+		}
+		if reloaded {
+			s.logger.Infof("Reloaded namespace mapping %s, version %s", s.path, s.Version().Version)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const validMapping = `
+- id: researchlab
+  subjects:
+    - fc:orgunit:systemavdelingen
+`
+
+func TestValidateNamespaceMappings(t *testing.T) {
+	_, err := ParseNamespaceMappings([]byte(`
+- id: researchlab
+  subjects:
+    - fc:orgunit:systemavdelingen
+- id: researchlab
+  subjects:
+    - fc:org:uninett.no
+- id: Research_Lab
+  subjects:
+    - fc:org:uninett.no
+- id: empty
+  subjects: []
+- id: jupyter
+  subjects:
+    - fc:org:uninett.no
+  hostPaths:
+    - ingress..host
+`))
+	if err == nil {
+		t.Fatal("invalid mapping was accepted")
+	}
+	for _, problem := range []string{"more than once", "invalid namespace name", "empty has no subjects", `jupyter: invalid values path "ingress..host"`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %q does not mention %q", err.Error(), problem)
+		}
+	}
+}
+
+func TestNamespaceMappingStoreReload(t *testing.T) {
+	f, err := ioutil.TempFile("", "subjects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(validMapping)
+	f.Close()
+
+	s, err := NewNamespaceMappingStore(f.Name(), logrus.NewEntry(logrus.StandardLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := s.Version().Version
+
+	// An invalid file must not replace the mapping.
+	ioutil.WriteFile(f.Name(), []byte("- id: researchlab\n"), 0644)
+	if reloaded, err := s.Reload(); reloaded || err == nil {
+		t.Fatal("invalid mapping was loaded")
+	}
+	if len(s.Mappings()) != 1 || s.Version().Version != version || s.Version().LastError == "" {
+		t.Errorf("last good mapping was not kept: %+v", s.Version())
+	}
+
+	ioutil.WriteFile(f.Name(), []byte(validMapping+"    - fc:org:uninett.no\n"), 0644)
+	if reloaded, err := s.Reload(); !reloaded || err != nil {
+		t.Fatalf("changed mapping was not loaded: %v", err)
+	}
+	if s.Version().Version == version || s.Version().LastError != "" {
+		t.Errorf("version was not updated: %+v", s.Version())
+	}
+	if subjects := s.Mappings()[0].AllowedSubjects; len(subjects) != 2 {
+		t.Errorf("mapping has unexpected subjects: %v", subjects)
+	}
+}
+
+func TestMergeNamespaceMappings(t *testing.T) {
+	file := []*NamespaceMapping{
+		{NamespaceId: "researchlab", Description: "Research Lab", AllowedSubjects: []string{"fc:org:uninett.no"}},
+	}
+	annotations := []*NamespaceMapping{
+		{
+			NamespaceId:     "researchlab",
+			AllowedSubjects: []string{"fc:org:uninett.no", "fc:adhoc:students"},
+			Roles:           map[Role][]string{RoleAdmin: {"fc:adhoc:managers"}},
+		},
+		{NamespaceId: "uninett-experimental", AllowedSubjects: []string{"fc:org:uninett.no"}},
+	}
+
+	merged := MergeNamespaceMappings(file, annotations)
+	if len(merged) != 2 {
+		t.Fatalf("unexpected number of namespaces: %d", len(merged))
+	}
+	n := merged[0]
+	if n.Description != "Research Lab" || len(n.AllowedSubjects) != 2 || n.RoleOf([]string{"fc:adhoc:managers"}) != RoleAdmin {
+		t.Errorf("namespace was not merged: %+v", n)
+	}
+	if len(file[0].AllowedSubjects) != 1 {
+		t.Errorf("merging modified the source mapping: %v", file[0].AllowedSubjects)
+	}
+}
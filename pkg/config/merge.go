@@ -0,0 +1,103 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+func appendMissing(subjects []string, more []string) []string {
+	for _, m := range more {
+		found := false
+		for _, s := range subjects {
+			if s == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			subjects = append(subjects, m)
+		}
+	}
+
+	return subjects
+}
+
+// Merge namespace mappings from several sources. Namespaces mapped by
+// more than one source get the subjects and roles from all of them, and
+// the first description, domain, values and quota found.
+func MergeNamespaceMappings(sources ...[]*NamespaceMapping) []*NamespaceMapping {
+	merged := make([]*NamespaceMapping, 0)
+	byId := make(map[string]*NamespaceMapping)
+	for _, mappings := range sources {
+		for _, n := range mappings {
+			m, found := byId[n.NamespaceId]
+			if !found {
+				m = &NamespaceMapping{NamespaceId: n.NamespaceId}
+				byId[n.NamespaceId] = m
+				merged = append(merged, m)
+			}
+			if m.Description == "" {
+				m.Description = n.Description
+			}
+			if m.Domain == "" {
+				m.Domain = n.Domain
+			}
+			if m.HostPaths == nil {
+				m.HostPaths = n.HostPaths
+			}
+			if m.DefaultValues == nil {
+				m.DefaultValues = n.DefaultValues
+			}
+			if m.EnforcedValues == nil {
+				m.EnforcedValues = n.EnforcedValues
+			}
+			if m.Quota == nil {
+				m.Quota = n.Quota
+			}
+			m.AllowedSubjects = appendMissing(m.AllowedSubjects, n.AllowedSubjects)
+			for role, subjects := range n.Roles {
+				if m.Roles == nil {
+					m.Roles = make(map[Role][]string)
+				}
+				m.Roles[role] = appendMissing(m.Roles[role], subjects)
+			}
+		}
+	}
+
+	return merged
+}
+
+// MergedMappingSource combines the mappings of several sources, as
+// described by MergeNamespaceMappings.
+type MergedMappingSource struct {
+	Sources []MappingSource
+}
+
+func NewMergedMappingSource(sources ...MappingSource) *MergedMappingSource {
+	return &MergedMappingSource{Sources: sources}
+}
+
+func (m *MergedMappingSource) Mappings() []*NamespaceMapping {
+	mappings := make([][]*NamespaceMapping, len(m.Sources))
+	for i, s := range m.Sources {
+		mappings[i] = s.Mappings()
+	}
+
+	return MergeNamespaceMappings(mappings...)
+}
+
+func (m *MergedMappingSource) Version() MappingVersion {
+	v := MappingVersion{Source: "merged", Namespaces: len(m.Mappings())}
+	h := sha256.New()
+	for _, s := range m.Sources {
+		sv := s.Version()
+		h.Write([]byte(sv.Source + ":" + sv.Version + "\n"))
+		if sv.LoadedAt.After(v.LoadedAt) {
+			v.LoadedAt = sv.LoadedAt
+		}
+		v.Sources = append(v.Sources, sv)
+	}
+	v.Version = hex.EncodeToString(h.Sum(nil))[:12]
+
+	return v
+}
@@ -1,30 +1,211 @@
 package config
 
 import (
+	"fmt"
 	"github.com/ghodss/yaml"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/UNINETT/appstore/pkg/hostnames"
+	"github.com/UNINETT/appstore/pkg/quota"
+)
+
+// What a user may do in a namespace. Every role includes the
+// permissions of the roles below it.
+type Role string
+
+const (
+	RoleNone Role = ""
+	// May list the releases in the namespace and see their status.
+	RoleViewer Role = "viewer"
+	// May also install releases, and upgrade and delete their own.
+	RoleDeployer Role = "deployer"
+	// May manage every release in the namespace and see their values,
+	// including secrets.
+	RoleAdmin Role = "admin"
 )
 
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleDeployer: 2,
+	RoleAdmin:    3,
+}
+
+// Whether the role grants at least the permissions of required.
+func (r Role) Includes(required Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[required]
+}
+
+// Subjects may be patterns, see MatchSubjects.
 type NamespaceMapping struct {
-	NamespaceId     string   `json:"id"`
-	Description     string   `json:"description"`
-	AllowedSubjects []string `json:"subjects"`
+	NamespaceId string `json:"id"`
+	Description string `json:"description"`
+	// Subjects with the deployer role, kept for compatibility with
+	// mappings written before roles were introduced.
+	AllowedSubjects []string          `json:"subjects"`
+	Roles           map[Role][]string `json:"roles,omitempty"`
+	// Releases without an ingress host get one under this domain, and
+	// releases may only use hosts under it.
+	Domain string `json:"domain,omitempty"`
+	// The values holding the ingress hosts of the releases, such as
+	// ingress.hosts[], see hostnames.DefaultPaths. New hosts are set at
+	// the first path.
+	HostPaths []string `json:"hostPaths,omitempty"`
+	// Values used for every release in the namespace where the user
+	// gives none, e.g. the ingress domain or storage class.
+	DefaultValues map[string]interface{} `json:"defaultValues,omitempty"`
+	// Values used for every release in the namespace, replacing those
+	// given by the user, e.g. resource limits.
+	EnforcedValues map[string]interface{} `json:"enforcedValues,omitempty"`
+	// Limits of the releases in the namespace.
+	Quota *quota.Quota `json:"quota,omitempty"`
 }
 
-func LoadNamespaceMappings(yamlFilepath string) ([]*NamespaceMapping, error) {
-	filename, _ := filepath.Abs(yamlFilepath)
-	yamlFile, err := ioutil.ReadFile(filename)
+// The highest role granted to any of the subjects.
+func (n *NamespaceMapping) RoleOf(subjects []string) Role {
+	role, _ := n.Grant(NewSubjectSet(subjects))
+	return role
+}
 
-	if err != nil {
-		return nil, err
+// The highest role granted to the user, and the subject in the mapping
+// granting it.
+func (n *NamespaceMapping) Grant(subjects SubjectSet) (Role, string) {
+	role, granting, _ := n.grant(subjects)
+	return role, granting
+}
+
+// The subject of the user, e.g. a group, matched by the subject in the
+// mapping granting the highest role. With a pattern such as fc:org:* it
+// is the organization of the user, not the pattern.
+func (n *NamespaceMapping) GrantedSubject(subjects SubjectSet) string {
+	_, _, matched := n.grant(subjects)
+	return matched
+}
+
+func (n *NamespaceMapping) grant(subjects SubjectSet) (Role, string, string) {
+	candidates := []struct {
+		role     Role
+		subjects []string
+	}{
+		{RoleAdmin, n.Roles[RoleAdmin]},
+		{RoleDeployer, n.Roles[RoleDeployer]},
+		{RoleDeployer, n.AllowedSubjects},
+		{RoleViewer, n.Roles[RoleViewer]},
+	}
+	for _, c := range candidates {
+		if granting, matched, found := MatchSubjects(c.subjects, subjects); found {
+			return c.role, granting, matched
+		}
 	}
 
+	return RoleNone, "", ""
+}
+
+// The values holding the ingress hosts of the releases in the namespace.
+func (n *NamespaceMapping) HostValuePaths() []string {
+	if n == nil || len(n.HostPaths) == 0 {
+		return hostnames.DefaultPaths
+	}
+
+	return n.HostPaths
+}
+
+// Find the mapping of the namespace with the given id, or nil if it is
+// not mapped.
+func FindNamespace(namespaceMapping []*NamespaceMapping, namespaceId string) *NamespaceMapping {
+	for _, n := range namespaceMapping {
+		if n.NamespaceId == namespaceId {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Names of kubernetes namespaces must be DNS labels.
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Check the mapping for mistakes: duplicate or invalid namespace ids,
+// unknown roles and namespaces without subjects. All problems are
+// reported at once.
+func ValidateNamespaceMappings(namespaceMapping []*NamespaceMapping) error {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, n := range namespaceMapping {
+		if n == nil {
+			problems = append(problems, fmt.Sprintf("entry %d is empty", i))
+			continue
+		}
+		if !namespaceNamePattern.MatchString(n.NamespaceId) || len(n.NamespaceId) > 63 {
+			problems = append(problems, fmt.Sprintf("entry %d: invalid namespace name %q", i, n.NamespaceId))
+		}
+		if seen[n.NamespaceId] {
+			problems = append(problems, fmt.Sprintf("namespace %s is mapped more than once", n.NamespaceId))
+		}
+		seen[n.NamespaceId] = true
+
+		subjects := len(n.AllowedSubjects)
+		for _, s := range n.AllowedSubjects {
+			if emptySubject(s) {
+				problems = append(problems, fmt.Sprintf("namespace %s has an empty subject", n.NamespaceId))
+			}
+		}
+		for role, roleSubjects := range n.Roles {
+			if _, known := roleRanks[role]; !known {
+				problems = append(problems, fmt.Sprintf("namespace %s has unknown role %q", n.NamespaceId, role))
+			}
+			subjects += len(roleSubjects)
+			for _, s := range roleSubjects {
+				if emptySubject(s) {
+					problems = append(problems, fmt.Sprintf("namespace %s has an empty %s subject", n.NamespaceId, role))
+				}
+			}
+		}
+		if subjects == 0 {
+			problems = append(problems, fmt.Sprintf("namespace %s has no subjects", n.NamespaceId))
+		}
+		for _, path := range n.HostPaths {
+			if err := hostnames.ValidatePath(path); err != nil {
+				problems = append(problems, fmt.Sprintf("namespace %s: %s", n.NamespaceId, err.Error()))
+			}
+		}
+		if n.Quota != nil {
+			if err := n.Quota.Validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("namespace %s has an invalid quota: %s", n.NamespaceId, err.Error()))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid namespace mapping: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Parse and validate a namespace mapping.
+func ParseNamespaceMappings(data []byte) ([]*NamespaceMapping, error) {
 	var namespaceMapping []*NamespaceMapping
-	err = yaml.Unmarshal(yamlFile, &namespaceMapping)
+	err := yaml.Unmarshal(data, &namespaceMapping)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := ValidateNamespaceMappings(namespaceMapping); err != nil {
+		return nil, err
+	}
+
 	return namespaceMapping, nil
 }
+
+func LoadNamespaceMappings(yamlFilepath string) ([]*NamespaceMapping, error) {
+	filename, _ := filepath.Abs(yamlFilepath)
+	yamlFile, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNamespaceMappings(yamlFile)
+}
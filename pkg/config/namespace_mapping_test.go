@@ -0,0 +1,59 @@
+package config
+
+import "testing"
+
+func TestRoleOf(t *testing.T) {
+	n := &NamespaceMapping{
+		NamespaceId:     "researchlab",
+		AllowedSubjects: []string{"fc:org:uninett.no"},
+		Roles: map[Role][]string{
+			RoleViewer: {"fc:org:uninett.no", "fc:adhoc:students"},
+			RoleAdmin:  {"fc:adhoc:managers"},
+		},
+	}
+
+	tests := []struct {
+		subjects []string
+		expected Role
+	}{
+		{nil, RoleNone},
+		{[]string{"fc:org:example.org"}, RoleNone},
+		{[]string{"fc:adhoc:students"}, RoleViewer},
+		// The highest role granted to a subject wins.
+		{[]string{"fc:org:uninett.no"}, RoleDeployer},
+		{[]string{"fc:adhoc:students", "fc:adhoc:managers"}, RoleAdmin},
+	}
+	for _, test := range tests {
+		if role := n.RoleOf(test.subjects); role != test.expected {
+			t.Errorf("RoleOf(%v): got %q want %q", test.subjects, role, test.expected)
+		}
+	}
+}
+
+func TestRoleIncludes(t *testing.T) {
+	if !RoleAdmin.Includes(RoleDeployer) || !RoleDeployer.Includes(RoleViewer) {
+		t.Error("higher roles should include the lower ones")
+	}
+	if RoleViewer.Includes(RoleDeployer) || RoleNone.Includes(RoleViewer) {
+		t.Error("lower roles should not include the higher ones")
+	}
+}
+
+func TestGrantedSubject(t *testing.T) {
+	n := &NamespaceMapping{
+		NamespaceId:     "researchlab",
+		AllowedSubjects: []string{"fc:org:*"},
+		Roles:           map[Role][]string{RoleAdmin: {"fc:adhoc:managers"}},
+	}
+
+	subjects := NewSubjectSet([]string{"fc:org:uninett.no", "fc:adhoc:students"})
+	if role, granting := n.Grant(subjects); role != RoleDeployer || granting != "fc:org:*" {
+		t.Errorf("unexpected grant: %s by %s", role, granting)
+	}
+	if group := n.GrantedSubject(subjects); group != "fc:org:uninett.no" {
+		t.Errorf("expected the organization of the user, got %q", group)
+	}
+	if group := n.GrantedSubject(NewSubjectSet([]string{"fc:adhoc:managers", "fc:org:uninett.no"})); group != "fc:adhoc:managers" {
+		t.Errorf("expected the group granting the highest role, got %q", group)
+	}
+}
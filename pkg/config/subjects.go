@@ -0,0 +1,90 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// The subjects, e.g. groups, of a user.
+type SubjectSet map[string]bool
+
+func NewSubjectSet(subjects []string) SubjectSet {
+	set := make(SubjectSet, len(subjects))
+	for _, s := range subjects {
+		set[s] = true
+	}
+
+	return set
+}
+
+// Whether subject matches pattern, where * matches any sequence of
+// characters, including none.
+func matchPattern(pattern string, subject string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == subject
+	}
+	if !strings.HasPrefix(subject, parts[0]) {
+		return false
+	}
+	subject = subject[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(subject, part)
+		if i < 0 {
+			return false
+		}
+		subject = subject[i+len(part):]
+	}
+
+	return len(subject) >= len(last) && strings.HasSuffix(subject, last)
+}
+
+// The subject matching pattern. If several do, the first in sorted
+// order is returned, so that the same subjects always give the same one.
+func (set SubjectSet) match(pattern string) (string, bool) {
+	if !strings.Contains(pattern, "*") {
+		return pattern, set[pattern]
+	}
+	var matching []string
+	for s := range set {
+		if matchPattern(pattern, s) {
+			matching = append(matching, s)
+		}
+	}
+	if len(matching) == 0 {
+		return "", false
+	}
+	sort.Strings(matching)
+
+	return matching[0], true
+}
+
+// Find the entry in the subjects of a mapping that matches one of the
+// user's subjects. Entries may contain * wildcards, such as
+// fc:org:uninett.no:*, and entries starting with ! exclude matching
+// subjects: a list containing fc:org:uninett.no:* and
+// !fc:org:uninett.no:unit:AVD-U20* matches nobody in the AVD-U20 units,
+// even if they are also members of other units. Returns the entry, and
+// the subject of the user it matched.
+func MatchSubjects(patterns []string, subjects SubjectSet) (string, string, bool) {
+	granting, matched := "", ""
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if _, found := subjects.match(p[1:]); found {
+				return "", "", false
+			}
+		} else if granting == "" {
+			if s, found := subjects.match(p); found {
+				granting, matched = p, s
+			}
+		}
+	}
+
+	return granting, matched, granting != ""
+}
+
+// Whether the subject, or the pattern it excludes, is empty.
+func emptySubject(subject string) bool {
+	return strings.TrimSpace(strings.TrimPrefix(subject, "!")) == ""
+}
@@ -0,0 +1,52 @@
+package config
+
+import "testing"
+
+func TestMatchSubjects(t *testing.T) {
+	patterns := []string{
+		"fc:org:uninett.no:*",
+		"!fc:org:uninett.no:unit:AVD-U20*",
+		"fc:adhoc:bcca03b7-8193-4692-91e0-3c0715756a26",
+	}
+
+	tests := []struct {
+		groups   []string
+		granting string
+		matched  string
+	}{
+		{[]string{"fc:org:uninett.no:unit:AVD-U10"}, "fc:org:uninett.no:*", "fc:org:uninett.no:unit:AVD-U10"},
+		// The first matching group in sorted order is used.
+		{[]string{"fc:org:uninett.no:unit:AVD-U30", "fc:org:uninett.no:unit:AVD-U10"}, "fc:org:uninett.no:*", "fc:org:uninett.no:unit:AVD-U10"},
+		{[]string{"fc:adhoc:bcca03b7-8193-4692-91e0-3c0715756a26"}, "fc:adhoc:bcca03b7-8193-4692-91e0-3c0715756a26", "fc:adhoc:bcca03b7-8193-4692-91e0-3c0715756a26"},
+		// Exclusions win over the other subjects of the user.
+		{[]string{"fc:org:uninett.no:unit:AVD-U20-1", "fc:adhoc:bcca03b7-8193-4692-91e0-3c0715756a26"}, "", ""},
+		{[]string{"fc:org:uninett.no"}, "", ""},
+		{nil, "", ""},
+	}
+	for _, test := range tests {
+		granting, matched, found := MatchSubjects(patterns, NewSubjectSet(test.groups))
+		if granting != test.granting || matched != test.matched || found != (test.granting != "") {
+			t.Errorf("MatchSubjects(%v): got %q matching %q want %q matching %q", test.groups, granting, matched, test.granting, test.matched)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		matches          bool
+	}{
+		{"fc:org:*", "fc:org:uninett.no", true},
+		{"fc:org:*", "fc:org:", true},
+		{"fc:*:uninett.no", "fc:org:uninett.no", true},
+		{"fc:*:uninett.no", "fc:org:uninett.no:unit", false},
+		{"*a*a", "aa", true},
+		{"a*a", "a", false},
+		{"fc:org", "fc:org:uninett.no", false},
+	}
+	for _, test := range tests {
+		if matchPattern(test.pattern, test.subject) != test.matches {
+			t.Errorf("matchPattern(%q, %q): want %v", test.pattern, test.subject, test.matches)
+		}
+	}
+}
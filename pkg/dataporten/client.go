@@ -0,0 +1,228 @@
+package dataporten
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/metrics"
+	"github.com/UNINETT/appstore/pkg/tracing"
+)
+
+const (
+	DefaultGroupsURL      = "https://groups-api.dataporten.no/groups/"
+	DefaultClientAdminURL = "https://clientadmin.dataporten-api.no/clients/"
+	DefaultTimeout        = 10 * time.Second
+	DefaultMaxRetries     = 2
+	DefaultRetryBackoff   = 200 * time.Millisecond
+)
+
+// The Dataporten endpoints, used to label the metrics of requests.
+const (
+	endpointGroups       = "groups"
+	endpointCreateClient = "create_client"
+	endpointDeleteClient = "delete_client"
+)
+
+// Client talks to the Dataporten groups and clientadmin APIs.
+type Client struct {
+	// Base URL of the groups API, must end with a slash.
+	GroupsURL string
+	// Base URL of the clientadmin API, must end with a slash.
+	ClientAdminURL string
+	HTTPClient     *http.Client
+	// Timeout of a single request, used when HTTPClient has none.
+	Timeout time.Duration
+	// How many times idempotent requests are retried when Dataporten is
+	// unavailable. The wait between attempts starts at RetryBackoff and
+	// is doubled for every attempt.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	Breaker      *CircuitBreaker
+	// Used when a request is made without a request specific logger.
+	Logger *logrus.Entry
+}
+
+// Create a client using the production Dataporten endpoints.
+func NewClient(logger *logrus.Entry) *Client {
+	return &Client{
+		GroupsURL:      DefaultGroupsURL,
+		ClientAdminURL: DefaultClientAdminURL,
+		Timeout:        DefaultTimeout,
+		MaxRetries:     DefaultMaxRetries,
+		RetryBackoff:   DefaultRetryBackoff,
+		Breaker:        NewCircuitBreaker(5, 30*time.Second),
+		Logger:         logger,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+
+	return &http.Client{Timeout: c.Timeout}
+}
+
+func (c *Client) logger(logger *logrus.Entry) *logrus.Entry {
+	if logger != nil {
+		return logger
+	}
+	if c.Logger != nil {
+		return c.Logger
+	}
+
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+func isIdempotent(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "DELETE"
+}
+
+// The wait before the given retry, with some jitter so that concurrent
+// requests don't retry in lockstep.
+func (c *Client) backoff(retry int) time.Duration {
+	wait := c.RetryBackoff << uint(retry-1)
+	if wait <= 0 {
+		return 0
+	}
+
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func initAuthorizedRequest(ctx context.Context, method string, url string, body io.Reader, token string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	tracing.Inject(ctx, req.Header)
+	return req.WithContext(ctx), nil
+}
+
+// Make a single request. Responses outside the 2xx range are returned as
+// errors, and their bodies are closed.
+func (c *Client) executeRequest(ctx context.Context, method string, url string, body []byte, token string) (*http.Response, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := initAuthorizedRequest(ctx, method, url, bodyReader, token)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, &UnavailableError{Method: method, URL: url, Err: err}
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &UnavailableError{Method: method, URL: url, StatusCode: resp.StatusCode}
+	}
+
+	return nil, &StatusError{Method: method, URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// How a request to Dataporten ended, for the metrics. Requests canceled
+// by the caller are not counted as Dataporten being unavailable.
+func requestOutcome(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return metrics.OutcomeSuccess
+	case *StatusError:
+		return "rejected"
+	case *UnavailableError:
+		if e.Err == context.Canceled || e.Err == context.DeadlineExceeded {
+			return "canceled"
+		}
+		return "unavailable"
+	}
+	if err == ErrCircuitOpen {
+		return "circuit_open"
+	}
+
+	return metrics.OutcomeError
+}
+
+// Make a request to an endpoint of Dataporten, recording its outcome and
+// how long it took in the metrics, and tracing it.
+func (c *Client) do(ctx context.Context, endpoint string, method string, url string, body []byte, token string, logger *logrus.Entry) (*http.Response, error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "dataporten."+endpoint)
+	resp, err := c.retry(ctx, method, url, body, token, logger)
+	tracing.End(span, err)
+	metrics.ObserveDataporten(endpoint, requestOutcome(err), time.Since(start))
+
+	return resp, err
+}
+
+// Make a request to Dataporten, retrying idempotent requests with
+// backoff while Dataporten is unavailable. Gives up as soon as ctx is
+// done, or when the circuit breaker is open.
+func (c *Client) retry(ctx context.Context, method string, url string, body []byte, token string, logger *logrus.Entry) (*http.Response, error) {
+	logger = c.logger(logger)
+	attempts := 1
+	if isIdempotent(method) {
+		attempts += c.MaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff(attempt)
+			logger.Debugf("Retrying %s %s in %s: %s", method, url, wait, err.Error())
+			select {
+			case <-ctx.Done():
+				return nil, &UnavailableError{Method: method, URL: url, Err: ctx.Err()}
+			case <-time.After(wait):
+			}
+		}
+
+		if !c.Breaker.Allow() {
+			logger.Debugf("Not attempting %s %s, the circuit breaker is open", method, url)
+			return nil, ErrCircuitOpen
+		}
+
+		var resp *http.Response
+		resp, err = c.executeRequest(ctx, method, url, body, token)
+		switch err.(type) {
+		case nil, *StatusError:
+			// Dataporten answered, even if it was to reject the request.
+			c.Breaker.Success()
+			return resp, err
+		case *UnavailableError:
+			if ctx.Err() != nil {
+				// Canceled by the caller, which says nothing about
+				// whether Dataporten is available.
+				c.Breaker.Release()
+				return nil, err
+			}
+			c.Breaker.Failure()
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,165 @@
+package dataporten
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func newFlakyServer(failures int32) (*httptest.Server, *int32) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[{"id": "fc:org:uninett.no"}]`))
+	}))
+
+	return ts, &calls
+}
+
+func newTestClient(baseURL string) *Client {
+	c := NewFakeClient(baseURL)
+	c.RetryBackoff = time.Millisecond
+
+	return c
+}
+
+func TestRequestGroupsRetries(t *testing.T) {
+	ts, calls := newFlakyServer(2)
+	defer ts.Close()
+
+	groups, err := newTestClient(ts.URL).RequestGroups(context.Background(), "token", nil)
+	if err != nil {
+		t.Fatalf("request failed: %s", err.Error())
+	}
+	if len(groups) != 1 || *calls != 3 {
+		t.Errorf("unexpected result: %d groups after %d calls", len(groups), *calls)
+	}
+}
+
+func TestCreateClientIsNotRetried(t *testing.T) {
+	ts, calls := newFlakyServer(1)
+	defer ts.Close()
+
+	_, err := newTestClient(ts.URL).CreateClient(context.Background(), &ClientSettings{Name: "test"}, "token", nil)
+	if HTTPStatus(err) != http.StatusBadGateway {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("registration was attempted %d times", *calls)
+	}
+}
+
+func TestCreateClientDoesNotLogSecret(t *testing.T) {
+	_, ts, c := NewTestServer([]*FakeUser{{UserId: "user-1", Token: "token"}})
+	defer ts.Close()
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+
+	cs := &ClientSettings{Name: "jupyter", ClientSecret: "very-secret"}
+	res, err := c.CreateClient(context.Background(), cs, "token", logrus.NewEntry(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "very-secret") {
+		t.Errorf("the client secret was logged: %s", out.String())
+	}
+	if !strings.Contains(out.String(), res.ClientId) {
+		t.Errorf("the client id was not logged: %s", out.String())
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	ts, calls := newFlakyServer(100)
+	defer ts.Close()
+
+	c := newTestClient(ts.URL)
+	c.MaxRetries = 0
+	c.Breaker = NewCircuitBreaker(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		c.RequestGroups(context.Background(), "token", nil)
+	}
+
+	_, err := c.RequestGroups(context.Background(), "token", nil)
+	if err != ErrCircuitOpen || HTTPStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("dataporten was called %d times", *calls)
+	}
+}
+
+func TestRequestGroupsCancelled(t *testing.T) {
+	ts, _ := newFlakyServer(100)
+	defer ts.Close()
+
+	c := newTestClient(ts.URL)
+	c.RetryBackoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := c.RequestGroups(ctx, "token", nil)
+	if HTTPStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRequestGroupsCancelledKeepsBreakerClosed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(ts.URL)
+	c.Breaker = NewCircuitBreaker(1, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	c.RequestGroups(ctx, "token", nil)
+	if c.Breaker.Open() {
+		t.Error("a cancelled request opened the circuit breaker")
+	}
+}
+
+func TestRequestOutcome(t *testing.T) {
+	outcomes := map[string]error{
+		"success":      nil,
+		"rejected":     &StatusError{StatusCode: http.StatusUnauthorized},
+		"unavailable":  &UnavailableError{StatusCode: http.StatusBadGateway},
+		"canceled":     &UnavailableError{Err: context.DeadlineExceeded},
+		"circuit_open": ErrCircuitOpen,
+		"error":        &InvalidResponseError{Err: context.Canceled},
+	}
+	for expected, err := range outcomes {
+		if outcome := requestOutcome(err); outcome != expected {
+			t.Errorf("%v: expected %s, got %s", err, expected, outcome)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	ts, calls := newFlakyServer(1)
+	defer ts.Close()
+	c := newTestClient(ts.URL)
+
+	if err := c.Ping(context.Background()); err == nil {
+		t.Error("a failing Dataporten was reachable")
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Dataporten was unreachable: %s", err.Error())
+	}
+	if *calls != 2 {
+		t.Errorf("Dataporten was pinged %d times", *calls)
+	}
+}
@@ -0,0 +1,83 @@
+package dataporten
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Returned without contacting Dataporten while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("dataporten is unavailable: too many failed requests")
+
+// Dataporten could not be reached, or failed to handle the request.
+type UnavailableError struct {
+	Method string
+	URL    string
+	// Set when Dataporten answered with a server error.
+	StatusCode int
+	Err        error
+}
+
+func (e *UnavailableError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("dataporten request %s %s failed: %s", e.Method, e.URL, e.Err.Error())
+	}
+	return fmt.Sprintf("dataporten request %s %s failed: %s", e.Method, e.URL, http.StatusText(e.StatusCode))
+}
+
+// Whether the request failed because it timed out or was cancelled.
+func (e *UnavailableError) Timeout() bool {
+	if e.Err == context.DeadlineExceeded || e.Err == context.Canceled {
+		return true
+	}
+	netErr, ok := e.Err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// Dataporten rejected the request, e.g. because the token is invalid.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("dataporten request %s %s was rejected: %s", e.Method, e.URL, e.Status)
+}
+
+// Dataporten returned a response that could not be parsed.
+type InvalidResponseError struct {
+	Err error
+}
+
+func (e *InvalidResponseError) Error() string {
+	return "dataporten returned an invalid response: " + e.Err.Error()
+}
+
+// Map an error returned by the Client to the status code that should be
+// returned to the user.
+func HTTPStatus(err error) int {
+	switch e := err.(type) {
+	case *StatusError:
+		if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusNotFound {
+			return e.StatusCode
+		}
+		return http.StatusBadGateway
+	case *UnavailableError:
+		if e.Timeout() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusBadGateway
+	case *InvalidResponseError:
+		return http.StatusBadGateway
+	}
+
+	if err == ErrCircuitOpen {
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,200 @@
+package dataporten
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/m4rw3r/uuid"
+)
+
+// A user known to the fake Dataporten, identified by its token.
+type FakeUser struct {
+	UserId string   `json:"id"`
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Groups []string `json:"groups"`
+}
+
+// FakeServer implements the parts of the Dataporten auth, groups and
+// clientadmin APIs used by the appstore, backed by a static list of
+// users. Registered clients are only kept in memory.
+type FakeServer struct {
+	mu      sync.Mutex
+	users   map[string]*FakeUser
+	clients map[string]*RegisterClientResult
+	router  chi.Router
+}
+
+func NewFakeServer(users []*FakeUser) *FakeServer {
+	s := &FakeServer{
+		users:   make(map[string]*FakeUser),
+		clients: make(map[string]*RegisterClientResult),
+	}
+	for _, u := range users {
+		s.users[u.Token] = u
+	}
+
+	r := chi.NewRouter()
+	r.Get("/userinfo", s.userinfoHandler)
+	r.Get("/groups/me/groups", s.groupsHandler)
+	r.Post("/clients/", s.createClientHandler)
+	r.Delete("/clients/{clientId}", s.deleteClientHandler)
+	s.router = r
+
+	return s
+}
+
+// Start the fake Dataporten in a httptest.Server, and return a client
+// using it. The caller must close the server.
+func NewTestServer(users []*FakeUser) (*FakeServer, *httptest.Server, *Client) {
+	s := NewFakeServer(users)
+	ts := httptest.NewServer(s)
+
+	return s, ts, NewFakeClient(ts.URL)
+}
+
+// Create a client for a fake Dataporten served at baseURL.
+func NewFakeClient(baseURL string) *Client {
+	c := NewClient(nil)
+	c.GroupsURL = baseURL + "/groups/"
+	c.ClientAdminURL = baseURL + "/clients/"
+
+	return c
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// Look up a client registered through the fake clientadmin API.
+func (s *FakeServer) RegisteredClient(clientId string) (*RegisterClientResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, found := s.clients[clientId]
+	return c, found
+}
+
+// Look up the user owning token.
+func (s *FakeServer) Authenticate(token string) (*FakeUser, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, found := s.users[token]
+	return u, found
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func (s *FakeServer) authorizedUser(w http.ResponseWriter, r *http.Request) *FakeUser {
+	u, found := s.Authenticate(bearerToken(r))
+	if !found {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return nil
+	}
+
+	return u
+}
+
+// AuthMiddleware stands in for the laasctl-auth middleware: it only lets
+// requests with the X-Dataporten-Token of a known user through.
+func (s *FakeServer) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, found := s.Authenticate(r.Header.Get("X-Dataporten-Token"))
+		if !found {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		r.Header.Set("X-Dataporten-Userid", u.UserId)
+		r.Header.Set("X-Dataporten-Userid-Sec", "feide:"+u.Name)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *FakeServer) userinfoHandler(w http.ResponseWriter, r *http.Request) {
+	u := s.authorizedUser(w, r)
+	if u == nil {
+		return
+	}
+
+	render.JSON(w, r, map[string]interface{}{
+		"user": map[string]interface{}{
+			"userid": u.UserId,
+			"name":   u.Name,
+		},
+	})
+}
+
+func (s *FakeServer) groupsHandler(w http.ResponseWriter, r *http.Request) {
+	u := s.authorizedUser(w, r)
+	if u == nil {
+		return
+	}
+
+	groups := make([]*DataportenGroup, len(u.Groups))
+	for i, g := range u.Groups {
+		groups[i] = &DataportenGroup{GroupId: g}
+	}
+	render.JSON(w, r, groups)
+}
+
+func (s *FakeServer) createClientHandler(w http.ResponseWriter, r *http.Request) {
+	u := s.authorizedUser(w, r)
+	if u == nil {
+		return
+	}
+
+	var cs ClientSettings
+	if err := json.NewDecoder(r.Body).Decode(&cs); err != nil {
+		http.Error(w, fmt.Sprintf("invalid client settings: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if cs.Name == "" {
+		http.Error(w, "client name missing", http.StatusBadRequest)
+		return
+	}
+
+	id, err := uuid.V4()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	client := &RegisterClientResult{ClientId: id.String(), Owner: u.UserId, Admins: []string{}}
+
+	s.mu.Lock()
+	s.clients[client.ClientId] = client
+	s.mu.Unlock()
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, client)
+}
+
+func (s *FakeServer) deleteClientHandler(w http.ResponseWriter, r *http.Request) {
+	u := s.authorizedUser(w, r)
+	if u == nil {
+		return
+	}
+
+	clientId := chi.URLParam(r, "clientId")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, found := s.clients[clientId]
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	if client.Owner != u.UserId {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	delete(s.clients, clientId)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,169 @@
+package dataporten
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	DefaultGroupCacheTTL  = time.Minute
+	DefaultGroupCacheSize = 1000
+
+	// How long a lookup shared by concurrent requests may take. It is
+	// not bound to the request that started it, which may go away before
+	// the others.
+	groupLookupTimeout = 30 * time.Second
+)
+
+// Hits, misses and evictions of all group caches, published at
+// /debug/vars.
+var groupCacheMetrics = expvar.NewMap("dataporten_group_cache")
+
+type groupCacheEntry struct {
+	key     string
+	groups  []*DataportenGroup
+	expires time.Time
+}
+
+// A lookup in progress, shared by all concurrent requests for the same
+// token.
+type groupLookup struct {
+	done   chan struct{}
+	groups []*DataportenGroup
+	err    error
+}
+
+// GroupCache caches the group membership of a token for a limited time.
+// Tokens are only stored hashed. When the cache is full the least
+// recently used entry is evicted.
+type GroupCache struct {
+	client  *Client
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	lookups map[string]*groupLookup
+	now     func() time.Time
+}
+
+func NewGroupCache(client *Client, ttl time.Duration, maxSize int) *GroupCache {
+	return &GroupCache{
+		client:  client,
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		lookups: make(map[string]*groupLookup),
+		now:     time.Now,
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get the groups of the user owning token, from the cache if possible.
+// Concurrent lookups of the same token result in a single request to
+// Dataporten, which continues when the request starting it is canceled.
+func (c *GroupCache) Groups(ctx context.Context, token string, logger *logrus.Entry) ([]*DataportenGroup, error) {
+	key := hashToken(token)
+
+	c.mu.Lock()
+	if groups, found := c.get(key); found {
+		c.mu.Unlock()
+		groupCacheMetrics.Add("hits", 1)
+		return groups, nil
+	}
+	groupCacheMetrics.Add("misses", 1)
+
+	l, inProgress := c.lookups[key]
+	if !inProgress {
+		l = &groupLookup{done: make(chan struct{})}
+		c.lookups[key] = l
+		go c.lookup(key, token, l, logger)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.groups, l.err
+	case <-ctx.Done():
+		return nil, &UnavailableError{Method: "GET", URL: c.client.GroupsURL, Err: ctx.Err()}
+	}
+}
+
+func (c *GroupCache) lookup(key string, token string, l *groupLookup, logger *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), groupLookupTimeout)
+	defer cancel()
+	l.groups, l.err = c.client.RequestGroups(ctx, token, logger)
+
+	c.mu.Lock()
+	delete(c.lookups, key)
+	if l.err == nil {
+		c.add(key, l.groups)
+	}
+	c.mu.Unlock()
+	close(l.done)
+}
+
+// Remove all cached groups.
+func (c *GroupCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *GroupCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Must be called with c.mu held.
+func (c *GroupCache) get(key string) ([]*DataportenGroup, bool) {
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := elem.Value.(*groupCacheEntry)
+	if c.now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return entry.groups, true
+}
+
+// Must be called with c.mu held.
+func (c *GroupCache) add(key string, groups []*DataportenGroup) {
+	if elem, found := c.entries[key]; found {
+		c.remove(elem)
+	}
+	for c.maxSize > 0 && c.lru.Len() >= c.maxSize {
+		c.remove(c.lru.Back())
+		groupCacheMetrics.Add("evictions", 1)
+	}
+
+	entry := &groupCacheEntry{key: key, groups: groups, expires: c.now().Add(c.ttl)}
+	c.entries[key] = c.lru.PushFront(entry)
+}
+
+// Must be called with c.mu held.
+func (c *GroupCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*groupCacheEntry)
+	delete(c.entries, entry.key)
+}
@@ -0,0 +1,107 @@
+package dataporten
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newSlowGroupsServer(delay time.Duration) (*httptest.Server, *int32) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(delay)
+		w.Write([]byte(`[{"id": "fc:org:uninett.no"}]`))
+	}))
+
+	return ts, &calls
+}
+
+func TestGroupCacheExpires(t *testing.T) {
+	ts, calls := newSlowGroupsServer(0)
+	defer ts.Close()
+
+	now := time.Now()
+	c := NewGroupCache(NewFakeClient(ts.URL), time.Minute, 10)
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Groups(context.Background(), "token", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if *calls != 1 {
+		t.Errorf("dataporten was called %d times, want 1", *calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.Groups(context.Background(), "token", nil)
+	if *calls != 2 {
+		t.Errorf("expired entry was not refreshed")
+	}
+}
+
+func TestGroupCacheEvicts(t *testing.T) {
+	ts, _ := newSlowGroupsServer(0)
+	defer ts.Close()
+
+	c := NewGroupCache(NewFakeClient(ts.URL), time.Minute, 2)
+	for _, token := range []string{"a", "b", "c"} {
+		c.Groups(context.Background(), token, nil)
+	}
+	if c.Len() != 2 {
+		t.Errorf("cache has %d entries, want 2", c.Len())
+	}
+	if _, found := c.get(hashToken("a")); found {
+		t.Errorf("least recently used entry was not evicted")
+	}
+}
+
+func TestGroupCacheDeduplicatesLookups(t *testing.T) {
+	ts, calls := newSlowGroupsServer(50 * time.Millisecond)
+	defer ts.Close()
+
+	c := NewGroupCache(NewFakeClient(ts.URL), time.Minute, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if groups, err := c.Groups(context.Background(), "token", nil); err != nil || len(groups) != 1 {
+				t.Errorf("lookup failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if *calls != 1 {
+		t.Errorf("dataporten was called %d times, want 1", *calls)
+	}
+}
+
+func TestGroupCacheLookupOutlivesCanceledRequest(t *testing.T) {
+	ts, calls := newSlowGroupsServer(50 * time.Millisecond)
+	defer ts.Close()
+
+	c := NewGroupCache(NewFakeClient(ts.URL), time.Minute, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		c.Groups(ctx, "token", nil)
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if groups, err := c.Groups(context.Background(), "token", nil); err != nil || len(groups) != 1 {
+		t.Errorf("lookup failed after the first request was canceled: %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("dataporten was called %d times, want 1", *calls)
+	}
+}
@@ -1,14 +1,12 @@
 package dataporten
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/Sirupsen/logrus"
 	"io"
-	"net/http"
 )
 
-const dataportenGroupURL string = "https://groups-api.dataporten.no/groups/"
-
 // 'Client' is dataporten internal name for applications.
 type DataportenGroup struct {
 	GroupId string `json:"id"`
@@ -21,17 +19,20 @@ func ParseGroupResult(respBody io.ReadCloser, logger *logrus.Entry) ([]*Dataport
 
 	if err != nil {
 		logger.Debug("Dataporten returned invalid JSON " + err.Error())
-		return nil, err
+		return nil, &InvalidResponseError{err}
 	}
 
 	return groups, nil
 }
 
-func RequestGroups(token string, logger *logrus.Entry) (*http.Response, error) {
-	req, err := initAuthorizedRequest("GET", dataportenGroupURL+"me/groups", nil, token)
+// Get the groups of the user owning token.
+func (c *Client) RequestGroups(ctx context.Context, token string, logger *logrus.Entry) ([]*DataportenGroup, error) {
+	logger = c.logger(logger)
+	logger.Debugf("Attempting to get groups from %s", c.GroupsURL)
+	resp, err := c.do(ctx, endpointGroups, "GET", c.GroupsURL+"me/groups", nil, token, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	return executeRequest(req)
+	return ParseGroupResult(resp.Body, logger)
 }
@@ -2,11 +2,10 @@ package dataporten
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/m4rw3r/uuid"
@@ -14,8 +13,6 @@ import (
 	"github.com/UNINETT/appstore/pkg/parseutil"
 )
 
-const dataportenClientURL string = "https://clientadmin.dataporten-api.no/clients/"
-
 // 'Client' is dataporten internal name for applications.
 type ClientSettings struct {
 	Name            string   `json:"name"`
@@ -101,39 +98,23 @@ func MaybeGetSettings(settings map[string]interface{}) (*ClientSettings, error)
 	return clientSettings, nil
 }
 
-func initAuthorizedRequest(method string, url string, body io.Reader, token string) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, body)
-
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	return req, nil
-}
-
-func executeRequest(req *http.Request) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-
-	return client.Do(req)
-}
-
 func ParseRegistrationResult(respBody io.ReadCloser, logger *logrus.Entry) (*RegisterClientResult, error) {
 	regRes := new(RegisterClientResult)
 	defer respBody.Close()
 	err := json.NewDecoder(respBody).Decode(&regRes)
 
 	if err != nil {
-		logger.Fatal("Dataporten returned invalid JSON " + err.Error())
-		return nil, err
+		logger.Debug("Dataporten returned invalid JSON " + err.Error())
+		return nil, &InvalidResponseError{err}
 	}
 
 	return regRes, nil
 }
 
-func CreateClient(cs *ClientSettings, token string, logger *logrus.Entry) (*http.Response, error) {
+// Register a new client. Registration is not idempotent, and is
+// therefore never retried.
+func (c *Client) CreateClient(ctx context.Context, cs *ClientSettings, token string, logger *logrus.Entry) (*RegisterClientResult, error) {
+	logger = c.logger(logger)
 	if cs.ClientSecret == "" {
 		clientSecret, err := uuid.V4()
 		if err != nil {
@@ -147,23 +128,32 @@ func CreateClient(cs *ClientSettings, token string, logger *logrus.Entry) (*http
 	if err != nil {
 		return nil, err
 	}
-	logger.Debug("Preparing to register new dataporten client with settings: " + b.String())
+	// The settings include the client secret, so only the name is logged.
+	logger.Debugf("Preparing to register new dataporten client %s", cs.Name)
 
-	req, err := initAuthorizedRequest("POST", dataportenClientURL, b, token)
+	resp, err := c.do(ctx, endpointCreateClient, "POST", c.ClientAdminURL, b.Bytes(), token, logger)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	return executeRequest(req)
+	res, err := ParseRegistrationResult(resp.Body, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("Registered dataporten client %s with id %s", cs.Name, res.ClientId)
+
+	return res, nil
 }
 
-func DeleteClient(clientId string, token string, logger *logrus.Entry) (*http.Response, error) {
-	deleteUrl := dataportenClientURL + clientId
-	req, err := initAuthorizedRequest("DELETE", deleteUrl, nil, token)
+func (c *Client) DeleteClient(ctx context.Context, clientId string, token string, logger *logrus.Entry) error {
+	deleteUrl := c.ClientAdminURL + clientId
+	logger = c.logger(logger)
+	logger.Debugf("Attempting to delete client %s", deleteUrl)
+	resp, err := c.do(ctx, endpointDeleteClient, "DELETE", deleteUrl, nil, token, logger)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	resp.Body.Close()
 
-	return executeRequest(req)
+	return nil
 }
@@ -0,0 +1,32 @@
+package dataporten
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Check that the groups API can be reached, without a token. Any answer
+// but a server error means Dataporten is up, even if the request is
+// rejected. The circuit breaker is not consulted, nor affected.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequest("GET", c.GroupsURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return &UnavailableError{Method: "GET", URL: c.GroupsURL, Err: err}
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &UnavailableError{Method: "GET", URL: c.GroupsURL, StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
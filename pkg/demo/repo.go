@@ -0,0 +1,88 @@
+package demo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/helm/helmpath"
+	"k8s.io/helm/pkg/repo"
+
+	"github.com/UNINETT/appstore/pkg/helmutil"
+)
+
+const (
+	fixtureRepository    = "stable"
+	fixtureRepositoryURL = "http://127.0.0.1/demo-charts"
+)
+
+// SetupHelmHome creates a helm home in a temporary directory, with a
+// single repository containing the charts found in chartsDir. Every
+// chart directory is linked into the repository, so that
+// install.LocateChartPath finds it without downloading anything.
+func SetupHelmHome(chartsDir string, logger *logrus.Entry) (helmpath.Home, error) {
+	dir, err := ioutil.TempDir("", "appstore-demo-")
+	if err != nil {
+		return "", err
+	}
+	home := helmpath.Home(dir)
+
+	if err := helmutil.EnsureDirectories(home); err != nil {
+		return "", err
+	}
+
+	absChartsDir, err := filepath.Abs(chartsDir)
+	if err != nil {
+		return "", err
+	}
+	entries, err := ioutil.ReadDir(absChartsDir)
+	if err != nil {
+		return "", fmt.Errorf("could not read demo charts: %s", err.Error())
+	}
+
+	repoDir := filepath.Join(home.Repository(), fixtureRepository)
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return "", err
+	}
+
+	index := repo.NewIndexFile()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		chartDir := filepath.Join(absChartsDir, e.Name())
+		ch, err := chartutil.LoadDir(chartDir)
+		if err != nil {
+			logger.Warnf("Skipping invalid demo chart %s: %s", e.Name(), err.Error())
+			continue
+		}
+		md := ch.GetMetadata()
+		if err := os.Symlink(chartDir, filepath.Join(repoDir, md.Name)); err != nil {
+			return "", err
+		}
+		index.Add(md, fmt.Sprintf("%s-%s.tgz", md.Name, md.Version), fixtureRepositoryURL, "")
+		logger.Debugf("Added demo chart %s, version: %s", md.Name, md.Version)
+	}
+	index.SortEntries()
+
+	cacheFile := home.CacheIndex(fixtureRepository)
+	if err := index.WriteFile(cacheFile, 0644); err != nil {
+		return "", err
+	}
+
+	rf := repo.NewRepoFile()
+	rf.Add(&repo.Entry{
+		Name:  fixtureRepository,
+		URL:   fixtureRepositoryURL,
+		Cache: cacheFile,
+	})
+	if err := rf.WriteFile(home.RepositoryFile(), 0644); err != nil {
+		return "", err
+	}
+
+	return home, nil
+}
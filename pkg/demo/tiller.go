@@ -0,0 +1,366 @@
+package demo
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+	"k8s.io/helm/pkg/proto/hapi/version"
+)
+
+const tillerVersion = "v2.4.2+demo"
+
+// Generated names are tried as many times before a random suffix is
+// added, and as many times again with a suffix before giving up.
+const maxNameAttempts = 5
+
+var (
+	nameAdjectives = []string{"brave", "calm", "eager", "fuzzy", "jolly", "lucky", "quiet", "snappy", "wobbly", "zesty"}
+	nameNouns      = []string{"badger", "cat", "dolphin", "gopher", "heron", "lynx", "moose", "otter", "puffin", "walrus"}
+)
+
+// Tiller is an in-memory implementation of the Tiller release service.
+// It renders the chart templates, but never talks to a Kubernetes
+// cluster, which makes it usable for local frontend development.
+type Tiller struct {
+	mu sync.Mutex
+	// All revisions of all releases, keyed by the release name.
+	releases map[string][]*release.Release
+	logger   *logrus.Entry
+}
+
+var _ services.ReleaseServiceServer = &Tiller{}
+
+func NewTiller(logger *logrus.Entry) *Tiller {
+	return &Tiller{
+		releases: make(map[string][]*release.Release),
+		logger:   logger,
+	}
+}
+
+// Serve starts a gRPC server for the in-memory Tiller on the loopback
+// interface and returns the address the helm client should use.
+func (t *Tiller) Serve() (string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	srv := grpc.NewServer()
+	services.RegisterReleaseServiceServer(srv, t)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			t.logger.Errorf("Demo tiller stopped: %s", err.Error())
+		}
+	}()
+
+	return lis.Addr().String(), nil
+}
+
+func now() *timestamp.Timestamp {
+	return &timestamp.Timestamp{Seconds: time.Now().Unix()}
+}
+
+func (t *Tiller) generateName() (string, error) {
+	for i := 0; i < 2*maxNameAttempts; i++ {
+		name := fmt.Sprintf("%s-%s", nameAdjectives[rand.Intn(len(nameAdjectives))], nameNouns[rand.Intn(len(nameNouns))])
+		if i >= maxNameAttempts {
+			name = fmt.Sprintf("%s-%04x", name, rand.Intn(0x10000))
+		}
+		if _, exists := t.releases[name]; !exists {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no available release name found")
+}
+
+func (t *Tiller) latest(name string) (*release.Release, error) {
+	revisions, found := t.releases[name]
+	if !found || len(revisions) == 0 {
+		return nil, fmt.Errorf("release: %q not found", name)
+	}
+
+	return revisions[len(revisions)-1], nil
+}
+
+// render renders the chart templates the same way Tiller does, and
+// returns the concatenated manifest.
+func render(ch *chart.Chart, values *chart.Config, opts chartutil.ReleaseOptions) (string, error) {
+	vals, err := chartutil.ToRenderValues(ch, values, opts)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := engine.New().Render(ch, vals)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var manifest []string
+	for _, name := range names {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "_") || base == "NOTES.txt" || strings.TrimSpace(files[name]) == "" {
+			continue
+		}
+		manifest = append(manifest, fmt.Sprintf("---\n# Source: %s\n%s", name, files[name]))
+	}
+
+	return strings.Join(manifest, "\n"), nil
+}
+
+// resources creates a fake resource listing in the format returned by
+// Tiller, so that releaseutil.ParseResources has something to work on.
+func resources(rel *release.Release) string {
+	return fmt.Sprintf("==> v1beta1/Deployment\nNAME\tDESIRED\tCURRENT\tUP-TO-DATE\tAVAILABLE\tAGE\n%s\t1\t1\t1\t1\t1m\n", rel.Name)
+}
+
+func (t *Tiller) newRelease(name, namespace string, ch *chart.Chart, values *chart.Config, revision int32, isInstall bool) (*release.Release, error) {
+	if values == nil {
+		values = &chart.Config{}
+	}
+
+	manifest, err := render(ch, values, chartutil.ReleaseOptions{
+		Name:      name,
+		Namespace: namespace,
+		Revision:  int(revision),
+		IsInstall: isInstall,
+		IsUpgrade: !isInstall,
+		Time:      now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rel := &release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Chart:     ch,
+		Config:    values,
+		Manifest:  manifest,
+		Version:   revision,
+		Info: &release.Info{
+			FirstDeployed: now(),
+			LastDeployed:  now(),
+			Status:        &release.Status{Code: release.Status_DEPLOYED},
+			Description:   "Demo release",
+		},
+	}
+	rel.Info.Status.Resources = resources(rel)
+
+	return rel, nil
+}
+
+func (t *Tiller) ListReleases(req *services.ListReleasesRequest, stream services.ReleaseService_ListReleasesServer) error {
+	t.mu.Lock()
+	names := make([]string, 0, len(t.releases))
+	for name := range t.releases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rels []*release.Release
+	for _, name := range names {
+		rel, _ := t.latest(name)
+		if req.Namespace != "" && rel.Namespace != req.Namespace {
+			continue
+		}
+		if rel.Info.Status.Code == release.Status_DELETED {
+			continue
+		}
+		rels = append(rels, rel)
+	}
+	t.mu.Unlock()
+
+	return stream.Send(&services.ListReleasesResponse{
+		Count:    int64(len(rels)),
+		Total:    int64(len(rels)),
+		Releases: rels,
+	})
+}
+
+func (t *Tiller) GetReleaseStatus(ctx context.Context, req *services.GetReleaseStatusRequest) (*services.GetReleaseStatusResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rel, err := t.latest(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.GetReleaseStatusResponse{Name: rel.Name, Info: rel.Info, Namespace: rel.Namespace}, nil
+}
+
+func (t *Tiller) GetReleaseContent(ctx context.Context, req *services.GetReleaseContentRequest) (*services.GetReleaseContentResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rel, err := t.latest(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.GetReleaseContentResponse{Release: rel}, nil
+}
+
+func (t *Tiller) InstallRelease(ctx context.Context, req *services.InstallReleaseRequest) (*services.InstallReleaseResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name := req.Name
+	if name == "" {
+		var err error
+		if name, err = t.generateName(); err != nil {
+			return nil, err
+		}
+	} else if _, exists := t.releases[name]; exists && !req.ReuseName {
+		return nil, fmt.Errorf("a release named %q already exists", name)
+	}
+
+	rel, err := t.newRelease(name, req.Namespace, req.Chart, req.Values, 1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.DryRun {
+		t.releases[name] = []*release.Release{rel}
+		t.logger.Debugf("Demo tiller installed %s in %s", name, req.Namespace)
+	}
+
+	return &services.InstallReleaseResponse{Release: rel}, nil
+}
+
+func (t *Tiller) UpdateRelease(ctx context.Context, req *services.UpdateReleaseRequest) (*services.UpdateReleaseResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, err := t.latest(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	// Like Tiller, only deployed releases can be upgraded. Deleted ones
+	// have to be rolled back or installed again.
+	if current.Info.Status.Code != release.Status_DEPLOYED {
+		return nil, fmt.Errorf("%q has no deployed releases", req.Name)
+	}
+
+	values := req.Values
+	if values == nil || values.Raw == "" {
+		values = current.Config
+	}
+
+	rel, err := t.newRelease(req.Name, current.Namespace, req.Chart, values, current.Version+1, false)
+	if err != nil {
+		return nil, err
+	}
+	rel.Info.FirstDeployed = current.Info.FirstDeployed
+
+	if !req.DryRun {
+		current.Info.Status.Code = release.Status_SUPERSEDED
+		t.releases[req.Name] = append(t.releases[req.Name], rel)
+		t.logger.Debugf("Demo tiller upgraded %s to revision %d", req.Name, rel.Version)
+	}
+
+	return &services.UpdateReleaseResponse{Release: rel}, nil
+}
+
+func (t *Tiller) UninstallRelease(ctx context.Context, req *services.UninstallReleaseRequest) (*services.UninstallReleaseResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rel, err := t.latest(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	rel.Info.Status.Code = release.Status_DELETED
+	rel.Info.Deleted = now()
+	if req.Purge {
+		delete(t.releases, req.Name)
+	}
+	t.logger.Debugf("Demo tiller deleted %s", req.Name)
+
+	return &services.UninstallReleaseResponse{Release: rel}, nil
+}
+
+func (t *Tiller) GetVersion(ctx context.Context, req *services.GetVersionRequest) (*services.GetVersionResponse, error) {
+	return &services.GetVersionResponse{Version: &version.Version{SemVer: tillerVersion}}, nil
+}
+
+func (t *Tiller) RollbackRelease(ctx context.Context, req *services.RollbackReleaseRequest) (*services.RollbackReleaseResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, err := t.latest(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *release.Release
+	for _, rel := range t.releases[req.Name] {
+		if rel.Version == req.Version {
+			target = rel
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("release %q has no revision %d", req.Name, req.Version)
+	}
+
+	rel, err := t.newRelease(req.Name, current.Namespace, target.Chart, target.Config, current.Version+1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.DryRun {
+		current.Info.Status.Code = release.Status_SUPERSEDED
+		t.releases[req.Name] = append(t.releases[req.Name], rel)
+	}
+
+	return &services.RollbackReleaseResponse{Release: rel}, nil
+}
+
+func (t *Tiller) GetHistory(ctx context.Context, req *services.GetHistoryRequest) (*services.GetHistoryResponse, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	revisions, found := t.releases[req.Name]
+	if !found {
+		return nil, fmt.Errorf("release: %q not found", req.Name)
+	}
+
+	// Newest revision first, like Tiller.
+	history := make([]*release.Release, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if req.Max > 0 && int32(len(history)) >= req.Max {
+			break
+		}
+		history = append(history, revisions[i])
+	}
+
+	return &services.GetHistoryResponse{Releases: history}, nil
+}
+
+func (t *Tiller) RunReleaseTest(req *services.TestReleaseRequest, stream services.ReleaseService_RunReleaseTestServer) error {
+	return stream.Send(&services.TestReleaseResponse{Msg: "demo releases have no tests", Status: release.TestRun_SUCCESS})
+}
@@ -0,0 +1,120 @@
+package demo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/proto/hapi/services"
+)
+
+var testLogger = logrus.NewEntry(logrus.StandardLogger())
+
+func loadNginx(t *testing.T) *chart.Chart {
+	ch, err := chartutil.Load("../../demo/charts/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ch
+}
+
+func TestInstallAndUpgrade(t *testing.T) {
+	tiller := NewTiller(testLogger)
+	ch := loadNginx(t)
+	ctx := context.Background()
+
+	res, err := tiller.InstallRelease(ctx, &services.InstallReleaseRequest{Chart: ch, Namespace: "researchlab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := res.Release.Name
+	if name == "" || !strings.Contains(res.Release.Manifest, "# Source: nginx/templates/") {
+		t.Fatalf("unexpected release: %s, %q", name, res.Release.Manifest)
+	}
+	if _, err := tiller.InstallRelease(ctx, &services.InstallReleaseRequest{Chart: ch, Name: name, Namespace: "researchlab"}); err == nil {
+		t.Error("a release was installed with the name of an existing release")
+	}
+
+	_, err = tiller.UpdateRelease(ctx, &services.UpdateReleaseRequest{Name: name, Chart: ch, Values: &chart.Config{Raw: "replicas: 2\n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := tiller.GetReleaseStatus(ctx, &services.GetReleaseStatusRequest{Name: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Namespace != "researchlab" || status.Info.Status.Code != release.Status_DEPLOYED {
+		t.Errorf("unexpected status: %s, %s", status.Namespace, status.Info.Status.Code)
+	}
+
+	history, err := tiller.GetHistory(ctx, &services.GetHistoryRequest{Name: name, Max: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Releases) != 2 {
+		t.Fatalf("expected two revisions, got %d", len(history.Releases))
+	}
+	latest, first := history.Releases[0], history.Releases[1]
+	if latest.Version != 2 || latest.Config.Raw != "replicas: 2\n" || first.Info.Status.Code != release.Status_SUPERSEDED {
+		t.Errorf("unexpected history: %d %q, %s", latest.Version, latest.Config.Raw, first.Info.Status.Code)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tiller := NewTiller(testLogger)
+	ch := loadNginx(t)
+	ctx := context.Background()
+
+	if _, err := tiller.InstallRelease(ctx, &services.InstallReleaseRequest{Chart: ch, Name: "nginx-abc123", Namespace: "researchlab"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tiller.UninstallRelease(ctx, &services.UninstallReleaseRequest{Name: "nginx-abc123"}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := tiller.GetReleaseStatus(ctx, &services.GetReleaseStatusRequest{Name: "nginx-abc123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Info.Status.Code != release.Status_DELETED || status.Info.Deleted == nil {
+		t.Errorf("the release was not deleted: %s", status.Info.Status.Code)
+	}
+	if _, err := tiller.UpdateRelease(ctx, &services.UpdateReleaseRequest{Name: "nginx-abc123", Chart: ch}); err == nil {
+		t.Error("a deleted release was upgraded")
+	}
+	history, err := tiller.GetHistory(ctx, &services.GetHistoryRequest{Name: "nginx-abc123"})
+	if err != nil || len(history.Releases) != 1 {
+		t.Errorf("upgrading a deleted release changed its history: %v", err)
+	}
+
+	if _, err := tiller.UninstallRelease(ctx, &services.UninstallReleaseRequest{Name: "nginx-abc123", Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tiller.GetReleaseStatus(ctx, &services.GetReleaseStatusRequest{Name: "nginx-abc123"}); err == nil || !strings.HasSuffix(err.Error(), " not found") {
+		t.Errorf("a purged release was found: %v", err)
+	}
+}
+
+func TestGenerateName(t *testing.T) {
+	tiller := NewTiller(testLogger)
+	for _, adjective := range nameAdjectives {
+		for _, noun := range nameNouns {
+			tiller.releases[adjective+"-"+noun] = nil
+		}
+	}
+
+	// Once all the plain names are used, a suffix is added.
+	name, err := tiller.generateName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := tiller.releases[name]; exists || strings.Count(name, "-") != 2 {
+		t.Errorf("unexpected name: %s", name)
+	}
+}
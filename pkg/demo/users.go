@@ -0,0 +1,40 @@
+package demo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/UNINETT/appstore/pkg/dataporten"
+)
+
+// The users available when no users file is given.
+var DefaultUsers = []*dataporten.FakeUser{
+	{
+		UserId: "76a7a061-3c55-430d-8ee0-6f82ec42501f",
+		Name:   "Demo User",
+		Token:  "demo-token",
+		Groups: []string{"fc:org:uninett.no", "fc:orgunit:systemavdelingen"},
+	},
+}
+
+func LoadUsers(yamlFilepath string) ([]*dataporten.FakeUser, error) {
+	if yamlFilepath == "" {
+		return DefaultUsers, nil
+	}
+
+	filename, _ := filepath.Abs(yamlFilepath)
+	yamlFile, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []*dataporten.FakeUser
+	err = yaml.Unmarshal(yamlFile, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,68 @@
+package form
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Read the annotations of the Chart.yaml of the chart at path, which
+// may be a directory or an archive. They are read from the file as the
+// chart metadata of Helm does not keep them.
+func ChartAnnotations(path string) (map[string]string, error) {
+	data, err := readChartFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata.Annotations, nil
+}
+
+func readChartFile(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return ioutil.ReadFile(filepath.Join(path, "Chart.yaml"))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, os.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The Chart.yaml of the chart itself, not of its dependencies.
+		parts := strings.Split(header.Name, "/")
+		if len(parts) == 2 && parts[1] == "Chart.yaml" {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
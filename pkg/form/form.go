@@ -0,0 +1,251 @@
+// Package form describes the values of a chart as an install form, so
+// that the frontend does not need a hand written form for every chart.
+package form
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ghodss/yaml"
+)
+
+// The Chart.yaml annotation holding the form overrides of a chart, as a
+// YAML document.
+const Annotation = "appstore.uninett.no/form"
+
+// The group of the top level values which are not maps.
+const GeneralGroup = "general"
+
+// Where a form was derived from.
+const (
+	SourceSchema = "schema"
+	SourceValues = "values"
+)
+
+type Field struct {
+	// Dotted path of the value.
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Type        string        `json:"type"`
+	Default     interface{}   `json:"default,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+}
+
+// The fields of a top level map of the values, e.g. ingress.
+type Group struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Fields      []*Field `json:"fields"`
+}
+
+type Form struct {
+	Package string   `json:"package"`
+	Version string   `json:"version"`
+	Source  string   `json:"source"`
+	Groups  []*Group `json:"groups"`
+}
+
+type FieldOverride struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Move the field to another group, which is created if needed.
+	Group string        `json:"group"`
+	Enum  []interface{} `json:"enum"`
+}
+
+type GroupOverride struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Adjustments of a form given by the chart, e.g.
+//
+//	hidden: [image]
+//	fields:
+//	  resources.limits.memory:
+//	    title: Memory
+//	    enum: [512Mi, 1Gi, 2Gi]
+type Overrides struct {
+	// Fields, or whole groups, left out of the form.
+	Hidden []string                 `json:"hidden"`
+	Groups map[string]GroupOverride `json:"groups"`
+	Fields map[string]FieldOverride `json:"fields"`
+}
+
+func ParseOverrides(annotation string) (*Overrides, error) {
+	o := new(Overrides)
+	if err := yaml.Unmarshal([]byte(annotation), o); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Turn a key such as pullPolicy or client_secret into a title such as
+// "Pull policy".
+func Title(key string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = nil
+		}
+	}
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ':
+			flush()
+		case unicode.IsUpper(r) && i > 0 && !unicode.IsUpper(runes[i-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	if len(words) == 0 {
+		return key
+	}
+	title := strings.Join(words, " ")
+
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+func lastKey(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// The type of a value decoded from YAML or JSON.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case int, int64:
+		return "integer"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return "string"
+}
+
+func lookup(values map[string]interface{}, name string) (interface{}, bool) {
+	var current interface{} = values
+	for _, key := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (f *Form) group(name string) *Group {
+	for _, g := range f.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	g := &Group{Name: name, Title: Title(name), Fields: make([]*Field, 0)}
+	f.Groups = append(f.Groups, g)
+
+	return g
+}
+
+func hidden(name string, hide []string) bool {
+	for _, h := range hide {
+		if name == h || strings.HasPrefix(name, h+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply the overrides of the chart to the form.
+func (f *Form) Apply(o *Overrides) {
+	if o == nil {
+		return
+	}
+
+	groups := make([]*Group, 0, len(f.Groups))
+	moved := make(map[string][]*Field)
+	var movedTo []string
+	for _, g := range f.Groups {
+		if hidden(g.Name, o.Hidden) {
+			continue
+		}
+		fields := make([]*Field, 0, len(g.Fields))
+		for _, field := range g.Fields {
+			if hidden(field.Name, o.Hidden) {
+				continue
+			}
+			override, found := o.Fields[field.Name]
+			if found {
+				if override.Title != "" {
+					field.Title = override.Title
+				}
+				if override.Description != "" {
+					field.Description = override.Description
+				}
+				if len(override.Enum) > 0 {
+					field.Enum = override.Enum
+				}
+			}
+			if found && override.Group != "" && override.Group != g.Name {
+				if _, seen := moved[override.Group]; !seen {
+					movedTo = append(movedTo, override.Group)
+				}
+				moved[override.Group] = append(moved[override.Group], field)
+				continue
+			}
+			fields = append(fields, field)
+		}
+		g.Fields = fields
+		groups = append(groups, g)
+	}
+	f.Groups = groups
+	for _, name := range movedTo {
+		g := f.group(name)
+		g.Fields = append(g.Fields, moved[name]...)
+	}
+
+	for _, g := range f.Groups {
+		if override, found := o.Groups[g.Name]; found {
+			if override.Title != "" {
+				g.Title = override.Title
+			}
+			if override.Description != "" {
+				g.Description = override.Description
+			}
+		}
+	}
+	f.dropEmptyGroups()
+}
@@ -0,0 +1,135 @@
+package form
+
+import (
+	"reflect"
+	"testing"
+)
+
+const values = `# The image of the notebook
+image: jupyter/minimal-notebook:latest
+replicas: 1
+ingress:
+  # -- Host of the notebook, generated when empty
+  host: ""
+resources:
+  limits:
+    cpu: 500m
+    # Memory of the notebook
+    memory: 512Mi
+ports:
+  - name: http
+    port: 8888
+`
+
+func fieldNames(f *Form) map[string][]string {
+	names := make(map[string][]string)
+	for _, g := range f.Groups {
+		for _, field := range g.Fields {
+			names[g.Name] = append(names[g.Name], field.Name)
+		}
+	}
+
+	return names
+}
+
+func TestFromValues(t *testing.T) {
+	f, err := FromValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		GeneralGroup: {"image", "replicas", "ports"},
+		"ingress":    {"ingress.host"},
+		"resources":  {"resources.limits.cpu", "resources.limits.memory"},
+	}
+	if names := fieldNames(f); !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected fields: %v", names)
+	}
+
+	general := f.Groups[0].Fields
+	if general[0].Description != "The image of the notebook" || general[1].Type != "integer" || general[2].Type != "array" {
+		t.Errorf("unexpected general fields: %v, %v, %v", general[0], general[1], general[2])
+	}
+	if f.Groups[1].Fields[0].Description != "Host of the notebook, generated when empty" {
+		t.Errorf("unexpected description: %s", f.Groups[1].Fields[0].Description)
+	}
+	if f.Groups[2].Fields[1].Title != "Memory" || f.Groups[2].Fields[1].Default != "512Mi" {
+		t.Errorf("unexpected field: %v", f.Groups[2].Fields[1])
+	}
+}
+
+func TestFromSchema(t *testing.T) {
+	schema := `{
+  "type": "object",
+  "required": ["image"],
+  "properties": {
+    "image": {"type": "string", "description": "The image"},
+    "ingress": {
+      "type": "object",
+      "title": "Ingress",
+      "properties": {"host": {"type": ["string", "null"]}}
+    },
+    "mode": {"type": "string", "enum": ["lab", "notebook"], "default": "lab"}
+  }
+}`
+	f, err := FromSchema([]byte(schema), map[string]interface{}{"image": "jupyter/minimal-notebook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		GeneralGroup: {"image", "mode"},
+		"ingress":    {"ingress.host"},
+	}
+	if names := fieldNames(f); !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected fields: %v", names)
+	}
+	image := f.Groups[0].Fields[0]
+	if !image.Required || image.Default != "jupyter/minimal-notebook" {
+		t.Errorf("unexpected image field: %v", image)
+	}
+	if len(f.Groups[0].Fields[1].Enum) != 2 || f.Groups[1].Fields[0].Type != "string" {
+		t.Errorf("unexpected fields: %v, %v", f.Groups[0].Fields[1], f.Groups[1].Fields[0])
+	}
+}
+
+func TestApply(t *testing.T) {
+	f, err := FromValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := ParseOverrides(`
+hidden: [ports, ingress]
+groups:
+  resources:
+    title: Resources
+fields:
+  resources.limits.memory:
+    group: general
+    enum: [512Mi, 1Gi]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Apply(o)
+
+	expected := map[string][]string{
+		GeneralGroup: {"image", "replicas", "resources.limits.memory"},
+		"resources":  {"resources.limits.cpu"},
+	}
+	if names := fieldNames(f); !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected fields: %v", names)
+	}
+	if len(f.Groups[0].Fields[2].Enum) != 2 {
+		t.Errorf("the enum was not applied")
+	}
+}
+
+func TestTitle(t *testing.T) {
+	for key, title := range map[string]string{"pullPolicy": "Pull policy", "client_secret": "Client secret", "cpu": "Cpu"} {
+		if Title(key) != title {
+			t.Errorf("unexpected title of %s: %s", key, Title(key))
+		}
+	}
+}
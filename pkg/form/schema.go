@@ -0,0 +1,120 @@
+package form
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// The parts of a JSON schema used for forms.
+type jsonSchema struct {
+	Type        interface{}            `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Default     interface{}            `json:"default"`
+	Enum        []interface{}          `json:"enum"`
+	Properties  map[string]*jsonSchema `json:"properties"`
+	Required    []string               `json:"required"`
+}
+
+// The type of the schema, or the first type other than null if it has
+// several.
+func (s *jsonSchema) typeName() string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	if len(s.Properties) > 0 {
+		return "object"
+	}
+
+	return "string"
+}
+
+func (s *jsonSchema) requires(key string) bool {
+	for _, r := range s.Required {
+		if r == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedProperties(m map[string]*jsonSchema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Derive a form from the JSON schema of the values of a chart. Values
+// without a default in the schema default to those of the chart, given
+// in defaults. Each top level object is a group, the other top level
+// properties are in the general group.
+func FromSchema(schema []byte, defaults map[string]interface{}) (*Form, error) {
+	root := new(jsonSchema)
+	if err := json.Unmarshal(schema, root); err != nil {
+		return nil, err
+	}
+
+	f := &Form{Source: SourceSchema, Groups: make([]*Group, 0)}
+	var addFields func(g *Group, prefix string, parent *jsonSchema)
+	addFields = func(g *Group, prefix string, parent *jsonSchema) {
+		for _, key := range sortedProperties(parent.Properties) {
+			s := parent.Properties[key]
+			name := prefix + key
+			if s.typeName() == "object" && len(s.Properties) > 0 {
+				addFields(g, name+".", s)
+				continue
+			}
+			field := &Field{
+				Name:        name,
+				Title:       s.Title,
+				Type:        s.typeName(),
+				Default:     s.Default,
+				Description: s.Description,
+				Enum:        s.Enum,
+				Required:    parent.requires(key),
+			}
+			if field.Title == "" {
+				field.Title = Title(key)
+			}
+			if field.Default == nil {
+				field.Default, _ = lookup(defaults, name)
+			}
+			g.Fields = append(g.Fields, field)
+		}
+	}
+
+	general := &jsonSchema{Properties: make(map[string]*jsonSchema), Required: root.Required}
+	for _, key := range sortedProperties(root.Properties) {
+		s := root.Properties[key]
+		if s.typeName() != "object" || len(s.Properties) == 0 {
+			general.Properties[key] = s
+		}
+	}
+	addFields(f.group(GeneralGroup), "", general)
+	for _, key := range sortedProperties(root.Properties) {
+		s := root.Properties[key]
+		if s.typeName() == "object" && len(s.Properties) > 0 {
+			g := f.group(key)
+			if s.Title != "" {
+				g.Title = s.Title
+			}
+			g.Description = s.Description
+			addFields(g, key+".", s)
+		}
+	}
+	f.dropEmptyGroups()
+
+	return f, nil
+}
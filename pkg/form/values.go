@@ -0,0 +1,141 @@
+package form
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+var keyLine = regexp.MustCompile(`^(\s*)("[^"]+"|'[^']+'|[^\s#:'"-][^\s:#]*)\s*:(\s|$)`)
+
+// The keys of a values document in the order they appear, along with
+// the comments right above them.
+func scanValues(raw string) ([]string, map[string]string) {
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	var order []string
+	comments := make(map[string]string)
+	var pending []string
+
+	for _, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "---":
+			pending = nil
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			// helm-docs style comments
+			comment = strings.TrimSpace(strings.TrimPrefix(comment, "--"))
+			if comment != "" {
+				pending = append(pending, comment)
+			}
+			continue
+		}
+
+		m := keyLine.FindStringSubmatch(line)
+		if m == nil {
+			pending = nil
+			continue
+		}
+		indent := len(m[1])
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent, strings.Trim(m[2], `"'`)})
+
+		keys := make([]string, len(stack))
+		for i, l := range stack {
+			keys[i] = l.key
+		}
+		name := strings.Join(keys, ".")
+		order = append(order, name)
+		if len(pending) > 0 {
+			comments[name] = strings.Join(pending, " ")
+		}
+		pending = nil
+	}
+
+	return order, comments
+}
+
+// Infer a form from the default values of a chart, using the comments
+// above the values as descriptions. Each top level map is a group, the
+// other top level values are in the general group.
+func FromValues(raw string) (*Form, error) {
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	order, comments := scanValues(raw)
+
+	// Values the scanner did not see, e.g. in flow mappings, come last.
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range order {
+		if _, found := lookup(values, name); found && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	var missing []string
+	var collect func(prefix string, m map[string]interface{})
+	collect = func(prefix string, m map[string]interface{}) {
+		for _, k := range sortedKeys(m) {
+			name := prefix + k
+			if !seen[name] {
+				missing = append(missing, name)
+			}
+			if nested, ok := m[k].(map[string]interface{}); ok {
+				collect(name+".", nested)
+			}
+		}
+	}
+	collect("", values)
+	sort.Strings(missing)
+	names = append(names, missing...)
+
+	f := &Form{Source: SourceValues, Groups: make([]*Group, 0)}
+	for _, name := range names {
+		v, _ := lookup(values, name)
+		nested, isMap := v.(map[string]interface{})
+		topLevel := !strings.Contains(name, ".")
+		if isMap && len(nested) > 0 {
+			if topLevel {
+				f.group(name).Description = comments[name]
+			}
+			continue
+		}
+
+		groupName := GeneralGroup
+		if !topLevel {
+			groupName = name[:strings.Index(name, ".")]
+		}
+		g := f.group(groupName)
+		g.Fields = append(g.Fields, &Field{
+			Name:        name,
+			Title:       Title(lastKey(name)),
+			Type:        typeOf(v),
+			Default:     v,
+			Description: comments[name],
+		})
+	}
+	f.dropEmptyGroups()
+
+	return f, nil
+}
+
+func (f *Form) dropEmptyGroups() {
+	groups := make([]*Group, 0, len(f.Groups))
+	for _, g := range f.Groups {
+		if len(g.Fields) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	f.Groups = groups
+}
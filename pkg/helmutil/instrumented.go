@@ -0,0 +1,109 @@
+package helmutil
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/helm/pkg/helm"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	rls "k8s.io/helm/pkg/proto/hapi/services"
+
+	"github.com/UNINETT/appstore/pkg/metrics"
+	"github.com/UNINETT/appstore/pkg/tracing"
+)
+
+// A helm client recording the outcome and duration of the calls made to
+// Tiller, and tracing them as part of the request in ctx. Calls not
+// wrapped here are passed on as they are.
+type instrumentedClient struct {
+	helm.Interface
+	ctx context.Context
+}
+
+// Start observing a call, returning the function ending it.
+func (c *instrumentedClient) observe(call string) func(err error) {
+	start := time.Now()
+	_, span := tracing.Start(c.ctx, "tiller."+call)
+
+	return func(err error) {
+		tracing.End(span, err)
+		metrics.ObserveTiller(call, err, time.Since(start))
+	}
+}
+
+func (c *instrumentedClient) ListReleases(opts ...helm.ReleaseListOption) (*rls.ListReleasesResponse, error) {
+	done := c.observe("ListReleases")
+	res, err := c.Interface.ListReleases(opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) InstallRelease(chStr string, ns string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	done := c.observe("InstallRelease")
+	res, err := c.Interface.InstallRelease(chStr, ns, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) InstallReleaseFromChart(ch *chart.Chart, ns string, opts ...helm.InstallOption) (*rls.InstallReleaseResponse, error) {
+	done := c.observe("InstallReleaseFromChart")
+	res, err := c.Interface.InstallReleaseFromChart(ch, ns, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) DeleteRelease(rlsName string, opts ...helm.DeleteOption) (*rls.UninstallReleaseResponse, error) {
+	done := c.observe("DeleteRelease")
+	res, err := c.Interface.DeleteRelease(rlsName, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) ReleaseStatus(rlsName string, opts ...helm.StatusOption) (*rls.GetReleaseStatusResponse, error) {
+	done := c.observe("ReleaseStatus")
+	res, err := c.Interface.ReleaseStatus(rlsName, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) UpdateRelease(rlsName string, chStr string, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	done := c.observe("UpdateRelease")
+	res, err := c.Interface.UpdateRelease(rlsName, chStr, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) UpdateReleaseFromChart(rlsName string, ch *chart.Chart, opts ...helm.UpdateOption) (*rls.UpdateReleaseResponse, error) {
+	done := c.observe("UpdateReleaseFromChart")
+	res, err := c.Interface.UpdateReleaseFromChart(rlsName, ch, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) RollbackRelease(rlsName string, opts ...helm.RollbackOption) (*rls.RollbackReleaseResponse, error) {
+	done := c.observe("RollbackRelease")
+	res, err := c.Interface.RollbackRelease(rlsName, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) ReleaseContent(rlsName string, opts ...helm.ContentOption) (*rls.GetReleaseContentResponse, error) {
+	done := c.observe("ReleaseContent")
+	res, err := c.Interface.ReleaseContent(rlsName, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) ReleaseHistory(rlsName string, opts ...helm.HistoryOption) (*rls.GetHistoryResponse, error) {
+	done := c.observe("ReleaseHistory")
+	res, err := c.Interface.ReleaseHistory(rlsName, opts...)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) GetVersion(opts ...helm.VersionOption) (*rls.GetVersionResponse, error) {
+	done := c.observe("GetVersion")
+	res, err := c.Interface.GetVersion(opts...)
+	done(err)
+	return res, err
+}
@@ -1,8 +1,10 @@
 package helmutil
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"k8s.io/helm/pkg/getter"
 	"k8s.io/helm/pkg/helm"
@@ -33,10 +35,12 @@ func InitHelmSettings(debug bool, tillerHost string) *helm_env.EnvSettings {
 	return settings
 }
 
-func InitHelmClient(settings *helm_env.EnvSettings) helm.Interface {
+// Create a client for Tiller, whose calls are traced as part of the
+// request in ctx.
+func InitHelmClient(ctx context.Context, settings *helm_env.EnvSettings) helm.Interface {
 	options := []helm.Option{helm.Host(settings.TillerHost)}
 	// TODO: Add TLS related options.
-	return helm.NewClient(options...)
+	return &instrumentedClient{helm.NewClient(options...), ctx}
 }
 
 func EnsureDirectories(home helmpath.Home) error {
@@ -142,3 +146,38 @@ func EnsureRepoFileFormat(file string) error {
 
 	return nil
 }
+
+// Check that the indexes of the repositories are loaded, and that those
+// with charts were downloaded at most maxAge ago, unless maxAge is 0.
+func CheckRepos(settings *helm_env.EnvSettings, maxAge time.Duration) error {
+	rf, err := repo.LoadRepositoriesFile(settings.Home.RepositoryFile())
+	if err != nil {
+		return err
+	}
+
+	charts := 0
+	for _, re := range rf.Repositories {
+		f := settings.Home.CacheIndex(re.Name)
+		ind, err := repo.LoadIndexFile(f)
+		if err != nil {
+			return fmt.Errorf("the index of %q could not be loaded: %s", re.Name, err.Error())
+		}
+		if len(ind.Entries) == 0 {
+			continue
+		}
+		charts += len(ind.Entries)
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		if age := time.Since(fi.ModTime()); maxAge > 0 && age > maxAge {
+			return fmt.Errorf("the index of %q was downloaded %s ago", re.Name, age)
+		}
+	}
+	if charts == 0 {
+		return fmt.Errorf("there are no charts in the %d repositories", len(rf.Repositories))
+	}
+
+	return nil
+}
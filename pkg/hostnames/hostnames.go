@@ -0,0 +1,231 @@
+// Package hostnames allocates the ingress hostnames of releases, so that
+// no two releases claim the same host.
+package hostnames
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ghodss/yaml"
+)
+
+// The values holding the ingress hosts of a release, as used by the
+// appstore charts. Paths are keys separated by dots, where a key ending
+// in [] holds a list: ingress.hosts[] is a list of hosts, and
+// ingress.hosts[].host a list of objects with a host each.
+var DefaultPaths = []string{"ingress.host"}
+
+var keyPattern = regexp.MustCompile(`^[^.\[\]]+(\[\])?$`)
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?\.)*[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// The host is already used by another release.
+type ConflictError struct {
+	Host    string
+	Release string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("the host %s is already used by release %s", e.Host, e.Release)
+}
+
+func Normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+func Valid(host string) bool {
+	return len(host) <= 253 && hostnamePattern.MatchString(host)
+}
+
+// Check that path is a valid values path, see DefaultPaths.
+func ValidatePath(path string) error {
+	for _, key := range strings.Split(path, ".") {
+		if !keyPattern.MatchString(key) {
+			return fmt.Errorf("invalid values path %q", path)
+		}
+	}
+
+	return nil
+}
+
+// The key in a path, and whether it holds a list.
+func splitKey(key string) (string, bool) {
+	return strings.TrimSuffix(key, "[]"), strings.HasSuffix(key, "[]")
+}
+
+// Call fn with each host at the keys of a path below m, and a function
+// replacing the host in the values.
+func walk(m map[string]interface{}, keys []string, fn func(host string, replace func(string))) {
+	key, list := splitKey(keys[0])
+	rest := keys[1:]
+	if !list {
+		if len(rest) > 0 {
+			if next, ok := m[key].(map[string]interface{}); ok {
+				walk(next, rest, fn)
+			}
+		} else if host, ok := m[key].(string); ok && host != "" {
+			fn(host, func(h string) { m[key] = h })
+		}
+		return
+	}
+
+	items, _ := m[key].([]interface{})
+	for i, item := range items {
+		if len(rest) > 0 {
+			if next, ok := item.(map[string]interface{}); ok {
+				walk(next, rest, fn)
+			}
+		} else if host, ok := item.(string); ok && host != "" {
+			i := i
+			fn(host, func(h string) { items[i] = h })
+		}
+	}
+}
+
+// The hosts given in the values at any of the paths.
+func FromValues(values map[string]interface{}, paths []string) []string {
+	var hosts []string
+	for _, path := range paths {
+		walk(values, strings.Split(path, "."), func(host string, replace func(string)) {
+			hosts = append(hosts, host)
+		})
+	}
+
+	return hosts
+}
+
+// Normalize the hosts given in the values at any of the paths.
+func NormalizeValues(values map[string]interface{}, paths []string) {
+	for _, path := range paths {
+		walk(values, strings.Split(path, "."), func(host string, replace func(string)) {
+			replace(Normalize(host))
+		})
+	}
+}
+
+// The value holding host at the keys of a path.
+func build(keys []string, host string) interface{} {
+	if len(keys) == 0 {
+		return host
+	}
+	key, list := splitKey(keys[0])
+	value := build(keys[1:], host)
+	if list {
+		value = []interface{}{value}
+	}
+
+	return map[string]interface{}{key: value}
+}
+
+// Set the host at the first of the paths, creating the sections of the
+// values leading to it if needed. A list on the path is replaced by one
+// holding only the host.
+func SetInValues(values map[string]interface{}, paths []string, host string) {
+	keys := strings.Split(paths[0], ".")
+	m := values
+	for i, k := range keys {
+		key, list := splitKey(k)
+		if list || i == len(keys)-1 {
+			value := build(keys[i+1:], host)
+			if list {
+				value = []interface{}{value}
+			}
+			m[key] = value
+			return
+		}
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+}
+
+// Whether host is domain, or a host under it.
+func InDomain(host string, domain string) bool {
+	host, domain = Normalize(host), Normalize(strings.TrimPrefix(domain, "."))
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// The hostname given to a release without one.
+func Generate(releaseName string, domain string) string {
+	return Normalize(releaseName + "." + strings.TrimPrefix(domain, "."))
+}
+
+type manifestIngress struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Rules []struct {
+			Host string `json:"host"`
+		} `json:"rules"`
+		TLS []struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tls"`
+	} `json:"spec"`
+}
+
+// The hosts of the ingresses in a release manifest.
+func FromManifest(manifest string) []string {
+	var hosts []string
+	for _, doc := range strings.Split(manifest, "\n---") {
+		var ing manifestIngress
+		if err := yaml.Unmarshal([]byte(doc), &ing); err != nil || ing.Kind != "Ingress" {
+			continue
+		}
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host != "" {
+				hosts = append(hosts, Normalize(rule.Host))
+			}
+		}
+		for _, tls := range ing.Spec.TLS {
+			for _, host := range tls.Hosts {
+				hosts = append(hosts, Normalize(host))
+			}
+		}
+	}
+
+	return hosts
+}
+
+// Allocator keeps track of the hosts reserved by releases being
+// installed, which are not yet visible in Tiller.
+type Allocator struct {
+	mu       sync.Mutex
+	reserved map[string]string
+}
+
+func NewAllocator() *Allocator {
+	return &Allocator{reserved: make(map[string]string)}
+}
+
+// Reserve host for the release, unless it is used by another release
+// in used (mapping hosts to release names) or reserved by a concurrent
+// install. The returned function must be called once the release is
+// installed, or has failed to install.
+func (a *Allocator) Reserve(host string, releaseName string, used map[string]string) (func(), error) {
+	host = Normalize(host)
+	if !Valid(host) {
+		return nil, fmt.Errorf("invalid host %q", host)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if owner, found := used[host]; found && owner != releaseName {
+		return nil, &ConflictError{host, owner}
+	}
+	if owner, found := a.reserved[host]; found && owner != releaseName {
+		return nil, &ConflictError{host, owner}
+	}
+	a.reserved[host] = releaseName
+
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.reserved[host] == releaseName {
+			delete(a.reserved, host)
+		}
+	}, nil
+}
@@ -0,0 +1,133 @@
+package hostnames
+
+import (
+	"reflect"
+	"testing"
+)
+
+const manifest = `
+---
+# Source: jupyter/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: jupyter
+---
+# Source: jupyter/templates/ingress.yaml
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: jupyter
+spec:
+  tls:
+    - hosts:
+        - Jupyter.Example.org
+  rules:
+    - host: jupyter.example.org
+`
+
+func TestFromManifest(t *testing.T) {
+	hosts := FromManifest(manifest)
+	if !reflect.DeepEqual(hosts, []string{"jupyter.example.org", "jupyter.example.org"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	a := NewAllocator()
+	used := map[string]string{"jupyter.example.org": "jupyter-abc123"}
+
+	if _, err := a.Reserve("Jupyter.example.org.", "nginx-def456", used); err == nil {
+		t.Error("a host used by another release was reserved")
+	} else if _, conflict := err.(*ConflictError); !conflict {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+	if _, err := a.Reserve("jupyter.example.org", "jupyter-abc123", used); err != nil {
+		t.Errorf("a release could not keep its own host: %s", err.Error())
+	}
+
+	done, err := a.Reserve("nginx.example.org", "nginx-def456", used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Reserve("nginx.example.org", "nginx-ghi789", used); err == nil {
+		t.Error("a host reserved by a concurrent install was reserved")
+	}
+	done()
+	if _, err := a.Reserve("nginx.example.org", "nginx-ghi789", used); err != nil {
+		t.Errorf("a released host could not be reserved: %s", err.Error())
+	}
+
+	if _, err := a.Reserve("not a host", "nginx-def456", used); err == nil {
+		t.Error("an invalid host was reserved")
+	}
+}
+
+func TestValues(t *testing.T) {
+	values := map[string]interface{}{"image": "nginx"}
+	if hosts := FromValues(values, DefaultPaths); len(hosts) != 0 {
+		t.Errorf("found hosts in values without one: %v", hosts)
+	}
+	SetInValues(values, DefaultPaths, Generate("nginx-def456", "lab.example.org"))
+	if hosts := FromValues(values, DefaultPaths); !reflect.DeepEqual(hosts, []string{"nginx-def456.lab.example.org"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestValuesPaths(t *testing.T) {
+	paths := []string{"ingress.hosts[]", "ingress.tls[].hosts[]", "extraIngress.hosts[].host"}
+	values := map[string]interface{}{
+		"ingress": map[string]interface{}{
+			"hosts": []interface{}{"Jupyter.example.org", ""},
+			"tls": []interface{}{
+				map[string]interface{}{"hosts": []interface{}{"jupyter.example.org."}},
+			},
+		},
+		"extraIngress": map[string]interface{}{
+			"hosts": []interface{}{map[string]interface{}{"host": "api.example.org", "paths": []interface{}{"/"}}},
+		},
+	}
+	NormalizeValues(values, paths)
+	expected := []string{"jupyter.example.org", "jupyter.example.org", "api.example.org"}
+	if hosts := FromValues(values, paths); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+
+	for path, expected := range map[string]interface{}{
+		"ingress.hosts[]":      map[string]interface{}{"hosts": []interface{}{"nginx.example.org"}},
+		"ingress.hosts[].host": map[string]interface{}{"hosts": []interface{}{map[string]interface{}{"host": "nginx.example.org"}}},
+	} {
+		values := map[string]interface{}{}
+		SetInValues(values, []string{path}, "nginx.example.org")
+		if !reflect.DeepEqual(values["ingress"], expected) {
+			t.Errorf("%s: unexpected values: %v", path, values)
+		}
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	for path, valid := range map[string]bool{
+		"ingress.host":         true,
+		"ingress.hosts[].host": true,
+		"ingress..host":        false,
+		"ingress.hosts[0]":     false,
+		"":                     false,
+	} {
+		if err := ValidatePath(path); (err == nil) != valid {
+			t.Errorf("%q: expected valid %v", path, valid)
+		}
+	}
+}
+
+func TestInDomain(t *testing.T) {
+	for host, in := range map[string]bool{
+		"jupyter.lab.example.org": true,
+		"Lab.Example.org.":        true,
+		"jupyter.example.org":     false,
+		"jupyterlab.example.org":  false,
+	} {
+		if InDomain(host, ".lab.example.org") != in {
+			t.Errorf("%s: expected in the domain %v", host, in)
+		}
+	}
+}
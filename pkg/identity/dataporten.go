@@ -0,0 +1,59 @@
+package identity
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/dataporten"
+)
+
+// DataportenProvider identifies users by the headers set by the
+// Dataporten API gatekeeper, which must have been verified by the auth
+// middleware, and looks up their groups through the groups API.
+type DataportenProvider struct {
+	GroupCache *dataporten.GroupCache
+}
+
+func NewDataportenProvider(groupCache *dataporten.GroupCache) *DataportenProvider {
+	return &DataportenProvider{GroupCache: groupCache}
+}
+
+// Use the first secondary user id, such as feide:user@example.org, as
+// the display name, as the gatekeeper does not pass on the real name.
+func displayName(r *http.Request) string {
+	secondary := r.Header.Get("X-Dataporten-Userid-Sec")
+	if secondary == "" {
+		return ""
+	}
+	first := strings.TrimSpace(strings.Split(secondary, ",")[0])
+	if i := strings.Index(first, ":"); i >= 0 {
+		return first[i+1:]
+	}
+
+	return first
+}
+
+func (p *DataportenProvider) Identify(r *http.Request, logger *logrus.Entry) (*Identity, error) {
+	token := r.Header.Get("X-Dataporten-Token")
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	groups, err := p.GroupCache.Groups(r.Context(), token, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	id := &Identity{
+		UserId: r.Header.Get("X-Dataporten-Userid"),
+		Name:   displayName(r),
+		Groups: make([]string, len(groups)),
+	}
+	for i, g := range groups {
+		id.Groups[i] = g.GroupId
+	}
+
+	return id, nil
+}
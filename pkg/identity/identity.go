@@ -0,0 +1,64 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/dataporten"
+)
+
+// Returned when the request carries no valid credentials.
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+// The authenticated user behind a request.
+type Identity struct {
+	UserId string   `json:"id"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups"`
+}
+
+// Whether the user is a member of group.
+func (i *Identity) MemberOf(group string) bool {
+	for _, g := range i.Groups {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IdentityProvider resolves the user making a request.
+type IdentityProvider interface {
+	Identify(r *http.Request, logger *logrus.Entry) (*Identity, error)
+}
+
+const identityKey = "identity"
+
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, found := ctx.Value(identityKey).(*Identity)
+	return id, found && id != nil
+}
+
+// Map an error returned by an IdentityProvider to the status code that
+// should be returned to the user.
+func HTTPStatus(err error) int {
+	switch err.(type) {
+	case *TokenError:
+		return http.StatusUnauthorized
+	case *KeySetError:
+		return http.StatusBadGateway
+	}
+	if err == ErrUnauthenticated {
+		return http.StatusUnauthorized
+	}
+
+	return dataporten.HTTPStatus(err)
+}
@@ -0,0 +1,355 @@
+package identity
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SermoDigital/jose/crypto"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// Allowed clock skew when checking exp and nbf.
+	clockLeeway = time.Minute
+	// Unknown key ids don't cause the key set to be fetched more often
+	// than this, whether the last fetch succeeded or not.
+	minKeyRefreshInterval = time.Minute
+	// How long a fetch of the key set may take. The fetch is shared by
+	// the requests waiting for it, so it doesn't end with the request
+	// starting it.
+	keyFetchTimeout = 30 * time.Second
+)
+
+var signingMethods = map[string]crypto.SigningMethod{
+	"RS256": crypto.SigningMethodRS256,
+	"RS384": crypto.SigningMethodRS384,
+	"RS512": crypto.SigningMethodRS512,
+}
+
+// The token in the request could not be verified.
+type TokenError struct {
+	Reason string
+}
+
+func (e *TokenError) Error() string {
+	return "invalid token: " + e.Reason
+}
+
+// The keys of the identity provider could not be fetched.
+type KeySetError struct {
+	Err error
+}
+
+func (e *KeySetError) Error() string {
+	return "could not fetch the keys of the identity provider: " + e.Err.Error()
+}
+
+type OIDCConfig struct {
+	// Expected issuer of the tokens, e.g. https://keycloak.example.org/auth/realms/appstore
+	Issuer string
+	// Expected audience, usually the client id.
+	Audience string
+	// URL of the JSON Web Key Set used to verify the tokens. Discovered
+	// from the issuer when empty.
+	JWKSURL string
+	// Claims containing the user id, display name and groups. Nested
+	// claims are separated by dots, e.g. realm_access.roles.
+	UserIdClaim string
+	NameClaim   string
+	GroupsClaim string
+	HTTPClient  *http.Client
+}
+
+// OIDCProvider identifies users by a JWT bearer token issued by an
+// OpenID Connect provider, such as Keycloak. The signature is verified
+// against the keys published by the provider.
+type OIDCProvider struct {
+	config OIDCConfig
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+	// When the key set was last fetched, and why that failed if it did.
+	fetched  time.Time
+	fetchErr error
+	// The fetch of the key set in progress, nil when there is none.
+	fetching *keyFetch
+	now      func() time.Time
+}
+
+// A fetch of the key set, shared by the requests with unknown key ids.
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	if config.UserIdClaim == "" {
+		config.UserIdClaim = "sub"
+	}
+	if config.NameClaim == "" {
+		config.NameClaim = "name"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &OIDCProvider{
+		config: config,
+		keys:   make(map[string]*rsa.PublicKey),
+		now:    time.Now,
+	}
+}
+
+func (p *OIDCProvider) Identify(r *http.Request, logger *logrus.Entry) (*Identity, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, ErrUnauthenticated
+	}
+
+	claims, err := p.Verify(r.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		logger.Debugf("Rejected token: %s", err.Error())
+		return nil, err
+	}
+
+	id := &Identity{}
+	id.UserId, _ = lookupClaim(claims, p.config.UserIdClaim).(string)
+	id.Name, _ = lookupClaim(claims, p.config.NameClaim).(string)
+	if id.UserId == "" {
+		return nil, &TokenError{fmt.Sprintf("claim %s missing", p.config.UserIdClaim)}
+	}
+
+	switch groups := lookupClaim(claims, p.config.GroupsClaim).(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = strings.Fields(groups)
+	}
+
+	return id, nil
+}
+
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+
+	return current
+}
+
+func audienceMatches(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Verify the signature and the standard claims of a JWT, and return its
+// claims.
+func (p *OIDCProvider) Verify(ctx context.Context, rawToken string) (map[string]interface{}, error) {
+	token, err := jws.ParseJWT([]byte(rawToken))
+	if err != nil {
+		return nil, &TokenError{"not a JWT"}
+	}
+	header := token.(jws.JWS).Protected()
+	alg, _ := header.Get("alg").(string)
+	method, supported := signingMethods[alg]
+	if !supported {
+		return nil, &TokenError{fmt.Sprintf("unsupported algorithm %q", alg)}
+	}
+	kid, _ := header.Get("kid").(string)
+
+	key, err := p.key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.(jws.JWS).Verify(key, method); err != nil {
+		return nil, &TokenError{"invalid signature"}
+	}
+
+	claims := token.Claims()
+	if _, found := claims.Expiration(); !found {
+		return nil, &TokenError{"expiry missing"}
+	}
+	if err := claims.Validate(p.now(), clockLeeway, clockLeeway); err != nil {
+		return nil, &TokenError{err.Error()}
+	}
+	if iss, _ := claims.Issuer(); iss != p.config.Issuer {
+		return nil, &TokenError{fmt.Sprintf("unexpected issuer %q", iss)}
+	}
+	if !audienceMatches(claims.Get("aud"), p.config.Audience) {
+		return nil, &TokenError{"unexpected audience"}
+	}
+
+	return claims, nil
+}
+
+// Find the key with the given id, fetching the key set if it is unknown.
+// The key set is fetched without holding p.mu, so that known keys can be
+// looked up in the meantime.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	if key := p.lookupKey(kid); key != nil {
+		p.mu.Unlock()
+		return key, nil
+	}
+	f := p.fetching
+	if f == nil && !p.fetched.IsZero() && p.now().Sub(p.fetched) < minKeyRefreshInterval {
+		err := p.fetchErr
+		p.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return nil, &TokenError{fmt.Sprintf("unknown key %q", kid)}
+	}
+	if f == nil {
+		f = &keyFetch{done: make(chan struct{})}
+		p.fetching = f
+		go p.fetchKeySet(f)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, &KeySetError{ctx.Err()}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, &TokenError{fmt.Sprintf("unknown key %q", kid)}
+}
+
+// Fetch the key set for f, on a context of its own so that canceled
+// requests don't fail the fetch for the others waiting for it.
+func (p *OIDCProvider) fetchKeySet(f *keyFetch) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+	keys, err := p.fetchKeys(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		f.err = &KeySetError{err}
+	} else {
+		p.keys = keys
+	}
+	p.fetched = p.now()
+	p.fetchErr = f.err
+	p.fetching = nil
+	close(f.done)
+}
+
+// Must be called with p.mu held. Tokens without a key id can only be
+// verified when the key set contains a single key.
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+
+	return p.keys[kid]
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.config.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	jwksURL := p.config.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+		if err != nil {
+			return nil, err
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,162 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var testLogger = logrus.NewEntry(logrus.StandardLogger())
+
+func newKeySetServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func identify(p *OIDCProvider, token string) (*Identity, error) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return p.Identify(r, testLogger)
+}
+
+func TestOIDCProvider(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newKeySetServer(t, key)
+	defer ts.Close()
+
+	p := NewOIDCProvider(OIDCConfig{
+		Issuer:      "https://keycloak.example.org",
+		Audience:    "appstore",
+		JWKSURL:     ts.URL,
+		GroupsClaim: "realm_access.roles",
+	})
+	claims := map[string]interface{}{
+		"iss":          "https://keycloak.example.org",
+		"aud":          []string{"appstore", "account"},
+		"sub":          "user-1",
+		"name":         "Test User",
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"realm_access": map[string]interface{}{"roles": []string{"lab-managers", "students"}},
+	}
+
+	id, err := identify(p, signToken(t, key, claims))
+	if err != nil {
+		t.Fatalf("valid token was rejected: %s", err.Error())
+	}
+	if id.UserId != "user-1" || id.Name != "Test User" || !id.MemberOf("lab-managers") || len(id.Groups) != 2 {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	if _, err := identify(p, signToken(t, key, claims)); HTTPStatus(err) != http.StatusUnauthorized {
+		t.Errorf("expired token was accepted: %v", err)
+	}
+
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "other-client"
+	if _, err := identify(p, signToken(t, key, claims)); HTTPStatus(err) != http.StatusUnauthorized {
+		t.Errorf("token for another audience was accepted: %v", err)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	claims["aud"] = "appstore"
+	if _, err := identify(p, signToken(t, otherKey, claims)); HTTPStatus(err) != http.StatusUnauthorized {
+		t.Errorf("token with invalid signature was accepted: %v", err)
+	}
+}
+
+func TestOIDCKeyFetch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := newKeySetServer(t, key)
+	defer keySet.Close()
+	var fetches int32
+	failing := true
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		keySet.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	p := NewOIDCProvider(OIDCConfig{Issuer: "https://keycloak.example.org", Audience: "appstore", JWKSURL: ts.URL})
+	p.now = func() time.Time { return now }
+	token := signToken(t, key, map[string]interface{}{
+		"iss": "https://keycloak.example.org",
+		"aud": "appstore",
+		"sub": "user-1",
+		"exp": now.Add(time.Hour).Unix(),
+	})
+
+	// The request starting the fetch gives up, the fetch goes on.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Verify(ctx, token); HTTPStatus(err) != http.StatusBadGateway {
+		t.Errorf("expected the canceled request to fail: %v", err)
+	}
+	close(release)
+	if _, err := identify(p, token); HTTPStatus(err) != http.StatusBadGateway {
+		t.Errorf("expected the failed fetch to be reported: %v", err)
+	}
+	if _, err := identify(p, token); HTTPStatus(err) != http.StatusBadGateway {
+		t.Errorf("expected the failed fetch to be reported: %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("the key set was fetched %d times after failing", n)
+	}
+
+	failing = false
+	now = now.Add(minKeyRefreshInterval)
+	if _, err := identify(p, token); err != nil {
+		t.Errorf("valid token was rejected: %s", err.Error())
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("expected the key set to be fetched again, got %d fetches", n)
+	}
+}
@@ -2,10 +2,12 @@ package install
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 
 	"text/template"
@@ -13,6 +15,7 @@ import (
 	"github.com/Masterminds/sprig"
 	"github.com/Sirupsen/logrus"
 	"github.com/UNINETT/appstore/pkg/helmutil"
+	"github.com/UNINETT/appstore/pkg/tracing"
 	"github.com/ghodss/yaml"
 	helm_env "k8s.io/helm/pkg/helm/environment"
 
@@ -57,6 +60,68 @@ func mergeValues(dest map[string]interface{}, src map[string]interface{}) map[st
 	return dest
 }
 
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = copyValue(v)
+	}
+
+	return c
+}
+
+// Copy maps and lists, which are rendered in place.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return copyValues(v)
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyValue(item)
+		}
+		return c
+	}
+
+	return v
+}
+
+// Combine the values given by the user with the default and enforced
+// values of the namespace. The defaults are used where the user gave no
+// value, and the enforced values replace the user's. None of the maps
+// are modified.
+func ApplyNamespaceValues(values map[string]interface{}, defaultValues map[string]interface{}, enforcedValues map[string]interface{}) map[string]interface{} {
+	merged := mergeValues(copyValues(defaultValues), copyValues(values))
+	return mergeValues(merged, copyValues(enforcedValues))
+}
+
+// The values without those equal to defaultValues, the defaults applied
+// by ApplyNamespaceValues, so that other defaults can be applied in
+// their place. Maps left empty are removed. values is not modified.
+func RemoveDefaultValues(values map[string]interface{}, defaultValues map[string]interface{}) map[string]interface{} {
+	result := copyValues(values)
+	for k, d := range defaultValues {
+		v, exists := result[k]
+		if !exists {
+			continue
+		}
+		valueMap, valueIsMap := v.(map[string]interface{})
+		defaultMap, defaultIsMap := d.(map[string]interface{})
+		if valueIsMap && defaultIsMap {
+			if rest := RemoveDefaultValues(valueMap, defaultMap); len(rest) > 0 {
+				result[k] = rest
+				continue
+			}
+			delete(result, k)
+			continue
+		}
+		if reflect.DeepEqual(v, d) {
+			delete(result, k)
+		}
+	}
+
+	return result
+}
+
 func createValuesYaml(cs map[string]interface{}) ([]byte, error) {
 	base := map[string]interface{}{}
 	for k, v := range cs {
@@ -77,7 +142,15 @@ func createValuesYaml(cs map[string]interface{}) ([]byte, error) {
 // - URL
 //
 // If 'verify' is true, this will attempt to also verify the chart.
-func LocateChartPath(name, repo, version string, verify bool, keyring string, settings *helm_env.EnvSettings, logger *logrus.Entry) (string, error) {
+func LocateChartPath(ctx context.Context, name, repo, version string, verify bool, keyring string, settings *helm_env.EnvSettings, logger *logrus.Entry) (string, error) {
+	_, span := tracing.Start(ctx, "LocateChartPath", tracing.String("chart.name", name), tracing.String("chart.repo", repo), tracing.String("chart.version", version))
+	path, err := locateChartPath(name, repo, version, verify, keyring, settings, logger)
+	tracing.End(span, err)
+
+	return path, err
+}
+
+func locateChartPath(name, repo, version string, verify bool, keyring string, settings *helm_env.EnvSettings, logger *logrus.Entry) (string, error) {
 	logger.Debugf("Trying to locate: %s, version: %s", name, version)
 	name = repo + "/" + strings.TrimSpace(name)
 	version = strings.TrimSpace(version)
@@ -130,6 +203,15 @@ func LocateChartPath(name, repo, version string, verify bool, keyring string, se
 	return filename, fmt.Errorf("file %q not found", name)
 }
 
+// Load the chart at path, which may be a directory or an archive.
+func LoadChart(ctx context.Context, path string) (*chart.Chart, error) {
+	_, span := tracing.Start(ctx, "chartutil.Load", tracing.String("chart.path", path))
+	chartRequested, err := chartutil.Load(path)
+	tracing.End(span, err)
+
+	return chartRequested, err
+}
+
 func generateName(nameTemplate string) (string, error) {
 	t, err := template.New("name-template").Funcs(sprig.TxtFuncMap()).Parse(nameTemplate)
 	if err != nil {
@@ -203,7 +285,18 @@ func GetValsByKey(desiredKey string, rawVals string, logger *logrus.Entry) (map[
 	return desiredVals, nil
 }
 
-func InstallChart(chartRequested *chart.Chart, namespace string, chartSettings map[string]interface{}, settings *helm_env.EnvSettings, logger *logrus.Entry) (*release.Release, error) {
+// Install the chart as a release named name, or with a name chosen by
+// Tiller if name is empty.
+func InstallChart(ctx context.Context, chartRequested *chart.Chart, name string, namespace string, chartSettings map[string]interface{}, settings *helm_env.EnvSettings, logger *logrus.Entry) (*release.Release, error) {
+	return installChart(ctx, chartRequested, name, namespace, chartSettings, false, settings, logger)
+}
+
+// Render the release InstallChart would install, without installing it.
+func DryRunInstallChart(ctx context.Context, chartRequested *chart.Chart, name string, namespace string, chartSettings map[string]interface{}, settings *helm_env.EnvSettings, logger *logrus.Entry) (*release.Release, error) {
+	return installChart(ctx, chartRequested, name, namespace, chartSettings, true, settings, logger)
+}
+
+func installChart(ctx context.Context, chartRequested *chart.Chart, name string, namespace string, chartSettings map[string]interface{}, dryRun bool, settings *helm_env.EnvSettings, logger *logrus.Entry) (*release.Release, error) {
 	rawVals, err := createValuesYaml(chartSettings)
 	if err != nil {
 		return nil, err
@@ -235,9 +328,7 @@ func InstallChart(chartRequested *chart.Chart, namespace string, chartSettings m
 		namespace = defaultNamespace()
 	}
 
-	name := ""
-	dryRun := false
-	client := helmutil.InitHelmClient(settings)
+	client := helmutil.InitHelmClient(ctx, settings)
 	res, err := client.InstallReleaseFromChart(
 		chartRequested,
 		namespace,
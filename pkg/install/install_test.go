@@ -0,0 +1,126 @@
+package install
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var releaseNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func TestApplyNamespaceValues(t *testing.T) {
+	defaults := map[string]interface{}{
+		"ingress":   map[string]interface{}{"host": "example.org", "tls": true},
+		"resources": map[string]interface{}{"cpu": "1"},
+	}
+	enforced := map[string]interface{}{
+		"resources": map[string]interface{}{"cpu": "2"},
+		"owners":    []interface{}{"tmpl:{{ .User.ID }}"},
+	}
+	values := map[string]interface{}{
+		"ingress":   map[string]interface{}{"host": "jupyter.example.org"},
+		"resources": map[string]interface{}{"cpu": "8", "memory": "1Gi"},
+	}
+
+	merged := ApplyNamespaceValues(values, defaults, enforced)
+	expected := map[string]interface{}{
+		"ingress":   map[string]interface{}{"host": "jupyter.example.org", "tls": true},
+		"resources": map[string]interface{}{"cpu": "2", "memory": "1Gi"},
+		"owners":    []interface{}{"tmpl:{{ .User.ID }}"},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("unexpected values: got %v want %v", merged, expected)
+	}
+	merged["owners"].([]interface{})[0] = "user-1"
+	if defaults["ingress"].(map[string]interface{})["host"] != "example.org" || enforced["owners"].([]interface{})[0] != "tmpl:{{ .User.ID }}" {
+		t.Error("the namespace values were modified")
+	}
+}
+
+func TestRenderValues(t *testing.T) {
+	ctx := &TemplateContext{
+		User:      TemplateUser{ID: "user-1"},
+		Namespace: "researchlab",
+		Release:   TemplateRelease{Name: "jupyter-abc123"},
+	}
+	values := map[string]interface{}{
+		"ingress": map[string]interface{}{"host": "tmpl:{{ .Release.Name }}.{{ .Namespace }}.example.org"},
+		"owners":  []interface{}{"tmpl:{{ .User.ID }}", 42},
+		"secret":  "tmpl:{{ randAlphaNum 32 }}",
+		"literal": "{{ .Release.Name }}",
+		"escaped": "tmpl:tmpl:{{`{{`}}",
+	}
+
+	if err := RenderValues(values, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if host := values["ingress"].(map[string]interface{})["host"]; host != "jupyter-abc123.researchlab.example.org" {
+		t.Errorf("unexpected host: %v", host)
+	}
+	if owner := values["owners"].([]interface{})[0]; owner != "user-1" {
+		t.Errorf("unexpected owner: %v", owner)
+	}
+	if secret := values["secret"].(string); len(secret) != 32 {
+		t.Errorf("unexpected secret: %s", secret)
+	}
+	if values["literal"] != "{{ .Release.Name }}" || values["escaped"] != "tmpl:{{" {
+		t.Errorf("unmarked strings were rendered: %v, %v", values["literal"], values["escaped"])
+	}
+
+	for _, tmpl := range []string{
+		`tmpl:{{ env "HOME" }}`,
+		`tmpl:{{ range until 1000000000 }}x{{ end }}`,
+		`tmpl:{{ range until 60000 }}{{ range until 60000 }}{{ end }}{{ end }}`,
+		`tmpl:{{ range until 60000 }}xx{{ end }}`,
+		`tmpl:{{ repeat 100000 "x" }}`,
+	} {
+		if err := RenderValues(map[string]interface{}{"value": tmpl}, ctx); err == nil {
+			t.Errorf("%s was rendered", tmpl)
+		}
+	}
+}
+
+func TestGenerateReleaseName(t *testing.T) {
+	for packageName, prefix := range map[string]string{
+		"jupyter":                         "jupyter-",
+		"Deep_Learning.Tools":             "deep-learning-tools-",
+		`{{ env "DATAPORTEN_GK_CREDS" }}`: "env-dataporten-gk-creds-",
+		"{{}}":                            "release-",
+		strings.Repeat("a", 60):           strings.Repeat("a", 46) + "-",
+	} {
+		name, err := GenerateReleaseName(packageName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(name, prefix) || len(name) != len(prefix)+6 || !releaseNamePattern.MatchString(name) {
+			t.Errorf("unexpected name for %s: %s", packageName, name)
+		}
+	}
+}
+
+func TestRemoveDefaultValues(t *testing.T) {
+	defaults := map[string]interface{}{
+		"ingress":   map[string]interface{}{"host": "example.org", "tls": true},
+		"resources": map[string]interface{}{"cpu": "1"},
+		"owners":    []interface{}{"user-1"},
+	}
+	values := map[string]interface{}{
+		"ingress":   map[string]interface{}{"host": "jupyter.example.org", "tls": true},
+		"resources": map[string]interface{}{"cpu": "1"},
+		"owners":    []interface{}{"user-1"},
+		"replicas":  2,
+	}
+
+	removed := RemoveDefaultValues(values, defaults)
+	expected := map[string]interface{}{
+		"ingress":  map[string]interface{}{"host": "jupyter.example.org"},
+		"replicas": 2,
+	}
+	if !reflect.DeepEqual(removed, expected) {
+		t.Errorf("unexpected values: got %v want %v", removed, expected)
+	}
+	if len(values["ingress"].(map[string]interface{})) != 2 {
+		t.Error("the values were modified")
+	}
+}
@@ -0,0 +1,222 @@
+package install
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig"
+)
+
+const (
+	// Only strings starting with TemplatePrefix are rendered, without
+	// the prefix. Other strings are used as they are, even if they
+	// contain {{, as some charts render their values as templates
+	// themselves.
+	TemplatePrefix = "tmpl:"
+	// The size of a rendered string, and the number of items or
+	// characters templates may ask functions like until for.
+	maxRenderedSize = 64 * 1024
+	// How long rendering all the values of a release may take.
+	renderTimeout = time.Second
+)
+
+var errRenderTimeout = errors.New("rendering the values took too long")
+
+// The user installing or upgrading a release, as seen by value
+// templates.
+type TemplateUser struct {
+	ID     string
+	Name   string
+	Groups []string
+}
+
+type TemplateRelease struct {
+	Name    string
+	Package string
+}
+
+// What value templates such as {{ .User.ID }}, {{ .Namespace }} and
+// {{ .Release.Name }} are rendered with.
+type TemplateContext struct {
+	User      TemplateUser
+	Namespace string
+	Release   TemplateRelease
+}
+
+// Checks that a count asked for by a template is within the limits, and
+// that rendering has not taken too long. Called by the functions that
+// templates loop over, so that nested loops are stopped in time.
+type renderLimits struct {
+	deadline time.Time
+}
+
+func (l *renderLimits) check(count float64) error {
+	if count > maxRenderedSize {
+		return fmt.Errorf("%.0f is more than the %d allowed", count, maxRenderedSize)
+	}
+	if time.Now().After(l.deadline) {
+		return errRenderTimeout
+	}
+
+	return nil
+}
+
+// The sprig functions, except those reading the environment of the
+// server, which contains credentials. The functions making lists and
+// strings of a given length are limited.
+func templateFuncs(limits *renderLimits) template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	delete(funcs, "seq")
+
+	funcs["until"] = func(count int) ([]int, error) {
+		return untilStep(limits, 0, count, 1)
+	}
+	funcs["untilStep"] = func(start, stop, step int) ([]int, error) {
+		return untilStep(limits, start, stop, step)
+	}
+	funcs["repeat"] = func(count int, str string) (string, error) {
+		if err := limits.check(float64(count) * float64(len(str))); err != nil {
+			return "", err
+		}
+		return strings.Repeat(str, count), nil
+	}
+	for _, name := range []string{"randAlphaNum", "randAlpha", "randNumeric", "randAscii"} {
+		random, ok := funcs[name].(func(int) string)
+		if !ok {
+			delete(funcs, name)
+			continue
+		}
+		funcs[name] = func(count int) (string, error) {
+			if err := limits.check(float64(count)); err != nil {
+				return "", err
+			}
+			return random(count), nil
+		}
+	}
+
+	return funcs
+}
+
+func untilStep(limits *renderLimits, start, stop, step int) ([]int, error) {
+	if step == 0 || (step > 0 && start >= stop) || (step < 0 && start <= stop) {
+		return []int{}, nil
+	}
+	if err := limits.check(math.Abs(float64(stop)-float64(start)) / math.Abs(float64(step))); err != nil {
+		return nil, err
+	}
+
+	var items []int
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		items = append(items, i)
+	}
+	return items, nil
+}
+
+// Stops rendering once a value gets too large.
+type limitedBuffer struct {
+	strings.Builder
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxRenderedSize {
+		return 0, fmt.Errorf("the rendered value is larger than %d bytes", maxRenderedSize)
+	}
+	return b.Builder.Write(p)
+}
+
+// Render every string in values marked with TemplatePrefix, e.g.
+// "tmpl:{{ .Release.Name }}.example.org" or "tmpl:{{ randAlphaNum 32 }}".
+// A string starting with the prefix itself is written with the prefix
+// twice. The values are modified in place.
+func RenderValues(values map[string]interface{}, ctx *TemplateContext) error {
+	limits := &renderLimits{deadline: time.Now().Add(renderTimeout)}
+	funcs := templateFuncs(limits)
+	for k, v := range values {
+		rendered, err := renderValue(v, ctx, funcs, limits, k)
+		if err != nil {
+			return err
+		}
+		values[k] = rendered
+	}
+
+	return nil
+}
+
+func renderValue(v interface{}, ctx *TemplateContext, funcs template.FuncMap, limits *renderLimits, path string) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.HasPrefix(v, TemplatePrefix) {
+			return v, nil
+		}
+		if err := limits.check(0); err != nil {
+			return nil, err
+		}
+		t, err := template.New(path).Funcs(funcs).Option("missingkey=error").Parse(strings.TrimPrefix(v, TemplatePrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in %s: %s", path, err.Error())
+		}
+		var b limitedBuffer
+		if err := t.Execute(&b, ctx); err != nil {
+			return nil, fmt.Errorf("could not render %s: %s", path, err.Error())
+		}
+		return b.String(), nil
+	case map[string]interface{}:
+		for k, nested := range v {
+			rendered, err := renderValue(nested, ctx, funcs, limits, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = rendered
+		}
+		return v, nil
+	case []interface{}:
+		for i, nested := range v {
+			rendered, err := renderValue(nested, ctx, funcs, limits, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = rendered
+		}
+		return v, nil
+	}
+
+	return v, nil
+}
+
+// Characters not allowed in release names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+const nameSuffixChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// Generate a release name from the package name, so that the name is
+// known before the release is installed and can be used in templates.
+// The package name is reduced to a DNS label, followed by a random
+// suffix.
+func GenerateReleaseName(packageName string) (string, error) {
+	prefix := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(packageName), "-"), "-")
+	// Release names are limited to 53 characters by Tiller.
+	if len(prefix) > 46 {
+		prefix = strings.TrimRight(prefix[:46], "-")
+	}
+	if prefix == "" {
+		prefix = "release"
+	}
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	for i, b := range suffix {
+		suffix[i] = nameSuffixChars[int(b)%len(nameSuffixChars)]
+	}
+
+	return prefix + "-" + string(suffix), nil
+}
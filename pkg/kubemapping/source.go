@@ -0,0 +1,222 @@
+// Package kubemapping builds namespace mappings from the annotations of
+// kubernetes namespaces, so that the mapping is maintained along with the
+// namespaces themselves.
+package kubemapping
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+
+	"github.com/UNINETT/appstore/pkg/config"
+	"github.com/UNINETT/appstore/pkg/quota"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	annotationPrefix = "appstore.uninett.no/"
+	// Comma separated subjects with the deployer role, like the subjects
+	// of the file mapping.
+	SubjectsAnnotation    = annotationPrefix + "subjects"
+	ViewersAnnotation     = annotationPrefix + "viewers"
+	DeployersAnnotation   = annotationPrefix + "deployers"
+	AdminsAnnotation      = annotationPrefix + "admins"
+	DescriptionAnnotation = annotationPrefix + "description"
+	DomainAnnotation      = annotationPrefix + "domain"
+	// Comma separated values paths of the ingress hosts.
+	HostPathsAnnotation = annotationPrefix + "host-paths"
+	// YAML documents with the default and enforced values of the
+	// releases in the namespace.
+	DefaultValuesAnnotation  = annotationPrefix + "default-values"
+	EnforcedValuesAnnotation = annotationPrefix + "enforced-values"
+	// A YAML document with the quota of the namespace.
+	QuotaAnnotation = annotationPrefix + "quota"
+)
+
+var roleAnnotations = map[string]config.Role{
+	ViewersAnnotation:   config.RoleViewer,
+	DeployersAnnotation: config.RoleDeployer,
+	AdminsAnnotation:    config.RoleAdmin,
+}
+
+func splitSubjects(annotation string) []string {
+	var subjects []string
+	for _, s := range strings.Split(annotation, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			subjects = append(subjects, s)
+		}
+	}
+
+	return subjects
+}
+
+func parseValues(ns *v1.Namespace, annotation string) (map[string]interface{}, error) {
+	raw, found := ns.Annotations[annotation]
+	if !found {
+		return nil, nil
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %s", annotation, err.Error())
+	}
+
+	return values, nil
+}
+
+// Build the mapping of a namespace from its annotations. Returns false
+// if the namespace has no appstore subjects.
+func MappingFromNamespace(ns *v1.Namespace) (*config.NamespaceMapping, bool, error) {
+	n := &config.NamespaceMapping{
+		NamespaceId:     ns.Name,
+		Description:     ns.Annotations[DescriptionAnnotation],
+		Domain:          ns.Annotations[DomainAnnotation],
+		HostPaths:       splitSubjects(ns.Annotations[HostPathsAnnotation]),
+		AllowedSubjects: splitSubjects(ns.Annotations[SubjectsAnnotation]),
+	}
+	found := len(n.AllowedSubjects) > 0
+	for annotation, role := range roleAnnotations {
+		if subjects := splitSubjects(ns.Annotations[annotation]); len(subjects) > 0 {
+			if n.Roles == nil {
+				n.Roles = make(map[config.Role][]string)
+			}
+			n.Roles[role] = subjects
+			found = true
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	var err error
+	if n.DefaultValues, err = parseValues(ns, DefaultValuesAnnotation); err != nil {
+		return nil, true, err
+	}
+	if n.EnforcedValues, err = parseValues(ns, EnforcedValuesAnnotation); err != nil {
+		return nil, true, err
+	}
+	if raw, found := ns.Annotations[QuotaAnnotation]; found {
+		n.Quota = new(quota.Quota)
+		if err := yaml.Unmarshal([]byte(raw), n.Quota); err != nil {
+			return nil, true, fmt.Errorf("invalid %s annotation: %s", QuotaAnnotation, err.Error())
+		}
+	}
+
+	return n, true, config.ValidateNamespaceMappings([]*config.NamespaceMapping{n})
+}
+
+// Source keeps a namespace mapping built from the annotated namespaces
+// in the cluster up to date, using an informer.
+type Source struct {
+	informer cache.SharedIndexInformer
+	logger   *logrus.Entry
+
+	mu       sync.RWMutex
+	mappings []*config.NamespaceMapping
+	version  config.MappingVersion
+}
+
+func NewSource(client kubernetes.Interface, resync time.Duration, logger *logrus.Entry) *Source {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().Namespaces().List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Namespaces().Watch(options)
+		},
+	}
+
+	s := &Source{
+		informer: cache.NewSharedIndexInformer(lw, &v1.Namespace{}, resync, cache.Indexers{}),
+		logger:   logger,
+		mappings: make([]*config.NamespaceMapping, 0),
+		version:  config.MappingVersion{Source: "kubernetes"},
+	}
+	rebuild := func(interface{}) { s.rebuild() }
+	s.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rebuild,
+		UpdateFunc: func(interface{}, interface{}) { s.rebuild() },
+		DeleteFunc: rebuild,
+	})
+
+	return s
+}
+
+// Watch the namespaces until stop is closed.
+func (s *Source) Run(stop <-chan struct{}) {
+	s.informer.Run(stop)
+}
+
+// Wait until the namespaces have been listed. Returns false if stop was
+// closed first.
+func (s *Source) WaitForSync(stop <-chan struct{}) bool {
+	if !cache.WaitForCacheSync(stop, s.informer.HasSynced) {
+		return false
+	}
+	s.rebuild()
+
+	return true
+}
+
+// Build the mapping from the namespaces currently known by the
+// informer. Namespaces with an invalid mapping are left out.
+func (s *Source) rebuild() {
+	var namespaces []*v1.Namespace
+	for _, obj := range s.informer.GetStore().List() {
+		if ns, ok := obj.(*v1.Namespace); ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+
+	mappings := make([]*config.NamespaceMapping, 0)
+	h := sha256.New()
+	for _, ns := range namespaces {
+		n, found, err := MappingFromNamespace(ns)
+		if !found {
+			continue
+		}
+		if err != nil {
+			s.logger.Warnf("Ignoring the appstore annotations of namespace %s: %s", ns.Name, err.Error())
+			continue
+		}
+		mappings = append(mappings, n)
+		h.Write([]byte(ns.Name + "@" + ns.ResourceVersion + "\n"))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mappings = mappings
+	s.version = config.MappingVersion{
+		Source:     "kubernetes",
+		Version:    hex.EncodeToString(h.Sum(nil))[:12],
+		LoadedAt:   time.Now(),
+		Namespaces: len(mappings),
+	}
+}
+
+func (s *Source) Mappings() []*config.NamespaceMapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.mappings
+}
+
+func (s *Source) Version() config.MappingVersion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.version
+}
@@ -0,0 +1,57 @@
+package kubemapping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/UNINETT/appstore/pkg/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func namespace(name string, annotations map[string]string) *v1.Namespace {
+	return &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+}
+
+func TestSource(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		namespace("researchlab", map[string]string{
+			SubjectsAnnotation:    "fc:adhoc:students",
+			AdminsAnnotation:      "fc:adhoc:managers, fc:orgunit:systemavdelingen",
+			DescriptionAnnotation: "Research Lab",
+		}),
+		namespace("kube-system", nil),
+	)
+
+	s := NewSource(client, 0, logrus.NewEntry(logrus.StandardLogger()))
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.Run(stop)
+
+	timeout := make(chan struct{})
+	time.AfterFunc(5*time.Second, func() { close(timeout) })
+	if !s.WaitForSync(timeout) {
+		t.Fatal("namespaces were not listed")
+	}
+
+	mappings := s.Mappings()
+	if len(mappings) != 1 || mappings[0].NamespaceId != "researchlab" {
+		t.Fatalf("unexpected mappings: %v", mappings)
+	}
+	n := mappings[0]
+	if n.Description != "Research Lab" || n.RoleOf([]string{"fc:orgunit:systemavdelingen"}) != config.RoleAdmin || n.RoleOf([]string{"fc:adhoc:students"}) != config.RoleDeployer {
+		t.Errorf("mapping does not match the annotations: %+v", n)
+	}
+
+	file := config.NewStaticNamespaceMappingStore([]*config.NamespaceMapping{
+		{NamespaceId: "researchlab", Roles: map[config.Role][]string{config.RoleViewer: {"fc:org:uninett.no"}}},
+	})
+	merged := config.NewMergedMappingSource(file, s).Mappings()
+	if len(merged) != 1 || merged[0].RoleOf([]string{"fc:org:uninett.no"}) != config.RoleViewer || merged[0].RoleOf([]string{"fc:adhoc:managers"}) != config.RoleAdmin {
+		t.Errorf("sources were not merged: %+v", merged)
+	}
+}
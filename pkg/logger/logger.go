@@ -1,24 +1,117 @@
 package logger
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+
+	"github.com/UNINETT/appstore/pkg/metrics"
 )
 
 const httpProtoMajor = 1
 
+// Log formats supported by Configure.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Set the format and level of the standard logger.
+func Configure(format string, level string) error {
+	switch format {
+	case FormatText:
+		customFormatter := new(logrus.TextFormatter)
+		customFormatter.TimestampFormat = "2006-01-02 15:04:05"
+		customFormatter.FullTimestamp = true
+		logrus.SetFormatter(customFormatter)
+	case FormatJSON:
+		logrus.SetFormatter(new(logrus.JSONFormatter))
+	default:
+		return fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+	}
+
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(l)
+
+	return nil
+}
+
+// Fields describing a request which are only known once it is handled,
+// such as the user making it.
+type requestFields struct {
+	mu     sync.Mutex
+	fields logrus.Fields
+}
+
+// Add fields to the log lines of the request, both those logged by the
+// handlers after this and the line logged when the request completes.
+func AddRequestFields(ctx context.Context, fields logrus.Fields) {
+	rf, found := ctx.Value("logger.fields").(*requestFields)
+	if !found {
+		return
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for k, v := range fields {
+		rf.fields[k] = v
+	}
+}
+
+// Add the user making the request to its log lines.
+func SetUser(ctx context.Context, userId string, groups int) {
+	AddRequestFields(ctx, logrus.Fields{"user": userId, "groups": groups})
+}
+
+// Add the namespace and release targeted by the request to its log lines,
+// once they are known, and return entry with them.
+func WithTarget(ctx context.Context, entry *logrus.Entry, namespace string, release string) *logrus.Entry {
+	fields := logrus.Fields{}
+	if namespace != "" {
+		fields["target_namespace"] = namespace
+	}
+	if release != "" {
+		fields["release"] = release
+	}
+	AddRequestFields(ctx, fields)
+
+	return entry.WithFields(fields)
+}
+
+func requestFieldsOf(ctx context.Context) logrus.Fields {
+	fields := make(logrus.Fields)
+	rf, found := ctx.Value("logger.fields").(*requestFields)
+	if !found {
+		return fields
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for k, v := range rf.fields {
+		fields[k] = v
+	}
+
+	return fields
+}
+
 func RequestLogger(next http.Handler) http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		entry := extractFromReq(r)
 		lw := middleware.NewWrapResponseWriter(w, httpProtoMajor)
+		r = r.WithContext(context.WithValue(r.Context(), "logger.fields", &requestFields{fields: make(logrus.Fields)}))
 
 		t1 := time.Now()
 		defer func() {
 			t2 := time.Now()
-			logRequest(entry, lw, t2.Sub(t1))
+			logRequest(entry.WithFields(requestFieldsOf(r.Context())), lw, t2.Sub(t1))
+			observeRequest(r, lw, t2.Sub(t1))
 		}()
 
 		next.ServeHTTP(lw, r)
@@ -28,6 +121,7 @@ func RequestLogger(next http.Handler) http.Handler {
 }
 
 func extractFromReq(r *http.Request) *logrus.Entry {
+	// Replaced by SetUser once the user is authenticated.
 	user := "unknown"
 	reqID := middleware.GetReqID(r.Context())
 	entry := logrus.WithFields(logrus.Fields{
@@ -51,10 +145,33 @@ func extractFromReq(r *http.Request) *logrus.Entry {
 	return entry
 }
 
+// A logger for the handler of the request, with the user making it and
+// the release and namespace it targets, when known.
 func MakeAPILogger(r *http.Request) *logrus.Entry {
 	reqID := middleware.GetReqID(r.Context())
+	fields := requestFieldsOf(r.Context())
+	if release := chi.URLParam(r, "releaseName"); release != "" {
+		fields["release"] = release
+	}
+	if namespace := chi.URLParam(r, "namespaceId"); namespace != "" {
+		fields["target_namespace"] = namespace
+	}
+
+	return logrus.WithFields(fields).WithFields(logrus.Fields{"reqID": reqID, "namespace": "api"})
+}
+
+func observeRequest(r *http.Request, w middleware.WrapResponseWriter, dt time.Duration) {
+	var route string
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		route = rctx.RoutePattern()
+	}
+	status := w.Status()
+	if status == 0 {
+		// Nothing was written, which net/http answers with 200.
+		status = http.StatusOK
+	}
 
-	return logrus.WithFields(logrus.Fields{"reqID": reqID, "namespace": "api"})
+	metrics.ObserveRequest(route, r.Method, status, dt)
 }
 
 func logRequest(logEntry *logrus.Entry, w middleware.WrapResponseWriter, dt time.Duration) {
@@ -65,5 +182,5 @@ func logRequest(logEntry *logrus.Entry, w middleware.WrapResponseWriter, dt time
 		"took_ns":       dt.Nanoseconds(),
 	})
 
-	logEntry.Debug("Request completed")
+	logEntry.Info("Request completed")
 }
@@ -0,0 +1,122 @@
+// Package manifest gives access to the objects of rendered release
+// manifests.
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// An object of a manifest, as decoded from YAML.
+type Object map[string]interface{}
+
+// The objects of a manifest, skipping empty documents. The items of
+// lists, such as kind: List, are returned instead of the lists, as
+// kubernetes creates them one by one.
+func Parse(manifest string) ([]Object, error) {
+	var objects []Object
+	for _, doc := range strings.Split(manifest, "\n---") {
+		var o Object
+		if err := yaml.Unmarshal([]byte(doc), &o); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %s", err.Error())
+		}
+		if o != nil {
+			objects = append(objects, o.items()...)
+		}
+	}
+
+	return objects, nil
+}
+
+// The object itself, or the items of a list, recursively.
+func (o Object) items() []Object {
+	if !strings.HasSuffix(o.Kind(), "List") {
+		return []Object{o}
+	}
+	var objects []Object
+	for _, item := range o.List("items") {
+		if i := AsObject(item); i != nil {
+			objects = append(objects, i.items()...)
+		}
+	}
+
+	return objects
+}
+
+func AsObject(v interface{}) Object {
+	m, _ := v.(map[string]interface{})
+	return Object(m)
+}
+
+func (o Object) Get(path ...string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(o)
+	for _, key := range path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func (o Object) List(path ...string) []interface{} {
+	l, _ := o.Get(path...)
+	items, _ := l.([]interface{})
+
+	return items
+}
+
+func (o Object) Kind() string {
+	kind, _ := o["kind"].(string)
+	return kind
+}
+
+// Kind/name of the object, e.g. Deployment/jupyter.
+func (o Object) ID() string {
+	name, _ := o.Get("metadata", "name")
+	return fmt.Sprintf("%s/%v", o.Kind(), name)
+}
+
+// Where the pod template of each kind of workload is.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+var replicatedKinds = map[string]bool{
+	"Deployment":            true,
+	"StatefulSet":           true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+}
+
+// The path of the pod spec of a workload, or false if the object does
+// not run pods.
+func (o Object) PodSpecPath() ([]string, bool) {
+	path, found := podSpecPaths[o.Kind()]
+	return path, found
+}
+
+// The replicas of a replicated workload, or false if the object is not
+// replicated or does not set them.
+func (o Object) Replicas() (int, bool) {
+	if !replicatedKinds[o.Kind()] {
+		return 0, false
+	}
+	replicas, _ := o.Get("spec", "replicas")
+	n, ok := replicas.(float64)
+
+	return int(n), ok
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The content type of the Prometheus text format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// The default buckets of latency histograms, in seconds.
+var defBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A metric written in the Prometheus text format.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(collectors ...collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, collectors...)
+}
+
+// Write the registered metrics, in the order they were registered.
+func writeAll(w io.Writer) error {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	writeAll(w)
+}
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func newDesc(name string, help string, labels ...string) desc {
+	return desc{name: namespace + "_" + name, help: help, labels: labels}
+}
+
+func (d desc) writeHeader(w *bufio.Writer, kind string) {
+	w.WriteString("# HELP " + d.name + " " + escapeHelp(d.help) + "\n")
+	w.WriteString("# TYPE " + d.name + " " + kind + "\n")
+}
+
+// A sample of the metric with the given suffix, e.g. _bucket. extra is
+// a label added to those of the series, such as le.
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, extra string, extraValue string, v float64) {
+	w.WriteString(name)
+	pairs := make([]string, 0, len(labels)+1)
+	for i, l := range labels {
+		pairs = append(pairs, l+`="`+escapeLabel(values[i])+`"`)
+	}
+	sort.Strings(pairs)
+	if extra != "" {
+		pairs = append(pairs, extra+`="`+escapeLabel(extraValue)+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(v) + "\n")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// The key of a series in a vector, from its label values.
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// Series keys of m, sorted so that scrapes are stable.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Counters partitioned by labels.
+type counterVec struct {
+	desc
+	mu     sync.Mutex
+	labels map[string][]string
+	values map[string]float64
+}
+
+func newCounterVec(d desc) *counterVec {
+	return &counterVec{desc: d, labels: make(map[string][]string), values: make(map[string]float64)}
+}
+
+// Add one to the counter with the given label values, which must be
+// as many as the labels of the vector.
+func (c *counterVec) inc(values ...string) {
+	key := seriesKey(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.labels[key]; !ok {
+		c.labels[key] = values
+	}
+	c.values[key]++
+}
+
+func (c *counterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.labels) {
+		writeSample(w, c.name, c.desc.labels, c.labels[key], "", "", c.values[key])
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histograms partitioned by labels.
+type histogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	labels  map[string][]string
+	values  map[string]*histogram
+}
+
+func newHistogramVec(d desc, buckets []float64) *histogramVec {
+	return &histogramVec{desc: d, buckets: buckets, labels: make(map[string][]string), values: make(map[string]*histogram)}
+}
+
+// Record v in the histogram with the given label values.
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := seriesKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.labels[key] = values
+		h.values[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.labels) {
+		s, values := h.values[key], h.labels[key]
+		for i, upper := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.desc.labels, values, "le", formatFloat(upper), float64(s.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.desc.labels, values, "le", "+Inf", float64(s.count))
+		writeSample(w, h.name+"_sum", h.desc.labels, values, "", "", s.sum)
+		writeSample(w, h.name+"_count", h.desc.labels, values, "", "", float64(s.count))
+	}
+}
+
+// A gauge whose value is given by a function when scraped.
+type gaugeFunc struct {
+	desc
+	value func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", g.value())
+}
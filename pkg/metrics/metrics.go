@@ -0,0 +1,144 @@
+// Package metrics collects the metrics of the appstore, and serves them
+// at /metrics in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const namespace = "appstore"
+
+// Outcomes of calls to Tiller and Dataporten, and of repo syncs.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// The route label of requests not matching any route, so that unknown
+// paths don't create new series.
+const unmatchedRoute = "unmatched"
+
+var (
+	requests = newCounterVec(newDesc("http_requests_total",
+		"Requests handled, by route, method and status.",
+		"route", "method", "status"))
+	requestDuration = newHistogramVec(newDesc("http_request_duration_seconds",
+		"Time taken to handle requests, by route, method and status.",
+		"route", "method", "status"), defBuckets)
+
+	tillerCalls = newCounterVec(newDesc("tiller_calls_total",
+		"Calls made to Tiller, by call and outcome.",
+		"call", "outcome"))
+	tillerDuration = newHistogramVec(newDesc("tiller_call_duration_seconds",
+		"Time taken by calls to Tiller, by call and outcome.",
+		"call", "outcome"), []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60})
+
+	dataportenRequests = newCounterVec(newDesc("dataporten_requests_total",
+		"Requests made to Dataporten, including retries, by endpoint and outcome.",
+		"endpoint", "outcome"))
+	dataportenDuration = newHistogramVec(newDesc("dataporten_request_duration_seconds",
+		"Time taken by requests to Dataporten, including retries, by endpoint and outcome.",
+		"endpoint", "outcome"), defBuckets)
+
+	searchIndexCharts = &gaugeFunc{newDesc("search_index_charts",
+		"Chart versions in the search index."), func() float64 {
+		indexMu.Lock()
+		defer indexMu.Unlock()
+		return float64(indexCharts)
+	}}
+	searchIndexAge = &gaugeFunc{newDesc("search_index_age_seconds",
+		"Time since the search index was built, 0 before it is built."), func() float64 {
+		indexMu.Lock()
+		defer indexMu.Unlock()
+		if indexBuilt.IsZero() {
+			return 0
+		}
+		return time.Since(indexBuilt).Seconds()
+	}}
+
+	releases = newCounterVec(newDesc("releases_total",
+		"Releases installed and deleted, by action, package and outcome. The package is empty when the action failed.",
+		"action", "package", "outcome"))
+
+	rateLimited = newCounterVec(newDesc("rate_limited_requests_total",
+		"Requests rejected because the client used up its budget, by budget.",
+		"budget"))
+
+	indexMu     sync.Mutex
+	indexBuilt  time.Time
+	indexCharts int
+)
+
+func init() {
+	register(
+		requests, requestDuration,
+		tillerCalls, tillerDuration,
+		dataportenRequests, dataportenDuration,
+		searchIndexCharts, searchIndexAge,
+		releases,
+		rateLimited,
+	)
+}
+
+// The handler serving the metrics, in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(serveMetrics)
+}
+
+// Record a request handled by route, the pattern it matched.
+func ObserveRequest(route string, method string, status int, took time.Duration) {
+	if route == "" {
+		route = unmatchedRoute
+	}
+	s := strconv.Itoa(status)
+	requests.inc(route, method, s)
+	requestDuration.observe(took.Seconds(), route, method, s)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+
+	return OutcomeSuccess
+}
+
+// Record a call to Tiller, e.g. InstallReleaseFromChart.
+func ObserveTiller(call string, err error, took time.Duration) {
+	o := outcome(err)
+	tillerCalls.inc(call, o)
+	tillerDuration.observe(took.Seconds(), call, o)
+}
+
+// Record a request to a Dataporten endpoint, e.g. groups. The outcome
+// tells how Dataporten answered, or why it did not.
+func ObserveDataporten(endpoint string, outcome string, took time.Duration) {
+	dataportenRequests.inc(endpoint, outcome)
+	dataportenDuration.observe(took.Seconds(), endpoint, outcome)
+}
+
+// Record that the search index was built with charts chart versions.
+func SetSearchIndex(charts int, built time.Time) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	indexBuilt = built
+	indexCharts = charts
+}
+
+// Record a release of package being installed or deleted. The package
+// is only recorded when the action succeeded, as it may otherwise be
+// any name given by the user.
+func CountRelease(action string, pkg string, outcome string) {
+	if outcome != OutcomeSuccess {
+		pkg = ""
+	}
+	releases.inc(action, pkg, outcome)
+}
+
+// Record a request rejected by the rate limiter.
+func CountRateLimited(budget string) {
+	rateLimited.inc(budget)
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T) string {
+	ts := httptest.NewServer(Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	ObserveRequest("", "GET", http.StatusNotFound, time.Millisecond)
+	ObserveTiller("ListReleases", nil, time.Millisecond)
+	CountRelease("install", "jupyter", "success")
+	CountRelease("install", "{{ made up }}", "failure")
+	CountRateLimited("write")
+	SetSearchIndex(3, time.Now())
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`appstore_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`appstore_tiller_calls_total{call="ListReleases",outcome="success"} 1`,
+		`appstore_releases_total{action="install",outcome="success",package="jupyter"} 1`,
+		`appstore_releases_total{action="install",outcome="failure",package=""} 1`,
+		`appstore_rate_limited_requests_total{budget="write"} 1`,
+		`appstore_search_index_charts 3`,
+		`# TYPE appstore_tiller_call_duration_seconds histogram`,
+		`appstore_tiller_call_duration_seconds_bucket{call="ListReleases",outcome="success",le="0.01"} 1`,
+		`appstore_tiller_call_duration_seconds_bucket{call="ListReleases",outcome="success",le="+Inf"} 1`,
+		`appstore_tiller_call_duration_seconds_count{call="ListReleases",outcome="success"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("%s is missing from the metrics", expected)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	CountRelease("install", "ignored", "bad \"outcome\"\n")
+
+	if body := scrape(t); !strings.Contains(body, `outcome="bad \"outcome\"\n",package=""} 1`) {
+		t.Errorf("the label value was not escaped:\n%s", body)
+	}
+}
@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UNINETT/appstore/pkg/manifest"
+)
+
+// Check the objects of a release manifest against the rules, returning
+// a *ViolationError if any of them breaks a rule.
+func Check(releaseManifest string, rules Rules) error {
+	objects, err := manifest.Parse(releaseManifest)
+	if err != nil {
+		return err
+	}
+	var violations []Violation
+	for _, o := range objects {
+		violations = append(violations, checkObject(o, rules)...)
+	}
+	if len(violations) > 0 {
+		return &ViolationError{violations}
+	}
+
+	return nil
+}
+
+func checkObject(o manifest.Object, rules Rules) []Violation {
+	var violations []Violation
+	violate := func(field, rule, message string) {
+		violations = append(violations, Violation{Object: o.ID(), Field: field, Rule: rule, Message: message})
+	}
+
+	if replicas, found := o.Replicas(); found && rules.MaxReplicas != nil && replicas > *rules.MaxReplicas {
+		violate("spec.replicas", "maxReplicas", fmt.Sprintf("%d replicas exceeds the maximum of %d", replicas, *rules.MaxReplicas))
+	}
+
+	specPath, found := o.PodSpecPath()
+	if !found {
+		return violations
+	}
+	prefix := strings.Join(specPath, ".")
+
+	if enabled(rules.DenyHostPath) {
+		for i, v := range o.List(append(specPath, "volumes")...) {
+			if _, ok := manifest.AsObject(v).Get("hostPath"); ok {
+				violate(fmt.Sprintf("%s.volumes[%d].hostPath", prefix, i), "denyHostPath", "hostPath volumes are not allowed")
+			}
+		}
+	}
+
+	for _, containerKind := range []string{"initContainers", "containers"} {
+		for i, c := range o.List(append(specPath, containerKind)...) {
+			container := manifest.AsObject(c)
+			field := fmt.Sprintf("%s.%s[%d]", prefix, containerKind, i)
+			if enabled(rules.DenyPrivileged) {
+				if privileged, _ := container.Get("securityContext", "privileged"); privileged == true {
+					violate(field+".securityContext.privileged", "denyPrivileged", "privileged containers are not allowed")
+				}
+			}
+			if enabled(rules.RequireLimits) {
+				for _, resource := range []string{"cpu", "memory"} {
+					if _, ok := container.Get("resources", "limits", resource); !ok {
+						violate(field+".resources.limits."+resource, "requireLimits", "a "+resource+" limit is required")
+					}
+				}
+			}
+			if rules.AllowedRegistries != nil {
+				image, _ := container["image"].(string)
+				if !allowedImage(image, rules.AllowedRegistries) {
+					violate(field+".image", "allowedRegistries", fmt.Sprintf("the image %s is not from an approved registry", image))
+				}
+			}
+		}
+	}
+
+	return violations
+}
+
+// The full name of an image, including the registry, without the tag
+// or digest, e.g. docker.io/library/nginx for nginx:1.13.
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return "docker.io/library/" + image
+	}
+	if !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return "docker.io/" + image
+	}
+
+	return image
+}
+
+func allowedImage(image string, registries []string) bool {
+	if image == "" {
+		return false
+	}
+	repository := imageRepository(image)
+	for _, r := range registries {
+		r = strings.TrimSuffix(r, "/")
+		if repository == r || strings.HasPrefix(repository, r+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+// Package policy checks the rendered manifests of releases against
+// rules, such as denying privileged containers, before they are
+// installed or upgraded.
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// The rules a release must follow. Rules left out are not checked.
+type Rules struct {
+	DenyPrivileged *bool `json:"denyPrivileged,omitempty"`
+	DenyHostPath   *bool `json:"denyHostPath,omitempty"`
+	// Require cpu and memory limits on every container.
+	RequireLimits *bool `json:"requireLimits,omitempty"`
+	// Registries, or registry paths such as docker.io/jupyter, images
+	// may be pulled from. Images without a registry are from docker.io.
+	AllowedRegistries []string `json:"allowedRegistries,omitempty"`
+	MaxReplicas       *int     `json:"maxReplicas,omitempty"`
+}
+
+// Policy holds the rules of every namespace, and the rules of specific
+// namespaces, which replace the default rules they set.
+type Policy struct {
+	Default    Rules            `json:"default"`
+	Namespaces map[string]Rules `json:"namespaces"`
+}
+
+func Parse(data []byte) (*Policy, error) {
+	p := new(Policy)
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %s", err.Error())
+	}
+	for ns, rules := range p.Namespaces {
+		if rules.MaxReplicas != nil && *rules.MaxReplicas < 0 {
+			return nil, fmt.Errorf("invalid policy: negative maxReplicas in namespace %s", ns)
+		}
+	}
+	if p.Default.MaxReplicas != nil && *p.Default.MaxReplicas < 0 {
+		return nil, fmt.Errorf("invalid policy: negative maxReplicas")
+	}
+
+	return p, nil
+}
+
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// The rules of namespace.
+func (p *Policy) For(namespace string) Rules {
+	if p == nil {
+		return Rules{}
+	}
+	rules := p.Default
+	scoped, found := p.Namespaces[namespace]
+	if !found {
+		return rules
+	}
+	if scoped.DenyPrivileged != nil {
+		rules.DenyPrivileged = scoped.DenyPrivileged
+	}
+	if scoped.DenyHostPath != nil {
+		rules.DenyHostPath = scoped.DenyHostPath
+	}
+	if scoped.RequireLimits != nil {
+		rules.RequireLimits = scoped.RequireLimits
+	}
+	if scoped.AllowedRegistries != nil {
+		rules.AllowedRegistries = scoped.AllowedRegistries
+	}
+	if scoped.MaxReplicas != nil {
+		rules.MaxReplicas = scoped.MaxReplicas
+	}
+
+	return rules
+}
+
+// A part of a manifest breaking a rule.
+type Violation struct {
+	// Kind/name of the object, e.g. Deployment/jupyter.
+	Object  string `json:"object"`
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// The manifest of a release breaks the policy.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = fmt.Sprintf("%s %s: %s", v.Object, v.Field, v.Message)
+	}
+
+	return "policy violations: " + strings.Join(messages, "; ")
+}
+
+func enabled(b *bool) bool {
+	return b != nil && *b
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testManifest = `
+---
+# Source: jupyter/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: jupyter
+---
+# Source: jupyter/templates/deployment.yaml
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: jupyter
+spec:
+  replicas: 3
+  template:
+    spec:
+      volumes:
+        - name: data
+          hostPath:
+            path: /data
+      containers:
+        - name: notebook
+          image: jupyter/minimal-notebook:latest
+          securityContext:
+            privileged: true
+          resources:
+            limits:
+              cpu: 500m
+        - name: proxy
+          image: quay.io/uninett/proxy:1.0
+          resources:
+            limits:
+              cpu: 100m
+              memory: 64Mi
+`
+
+const policy = `
+default:
+  denyPrivileged: true
+  denyHostPath: true
+  requireLimits: true
+  allowedRegistries: [docker.io/jupyter]
+  maxReplicas: 2
+namespaces:
+  researchlab:
+    denyHostPath: false
+    allowedRegistries: [docker.io, quay.io]
+    maxReplicas: 5
+`
+
+func TestCheck(t *testing.T) {
+	p, err := Parse([]byte(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Check(testManifest, p.For("default"))
+	verr, ok := err.(*ViolationError)
+	if !ok {
+		t.Fatalf("expected violations, got %v", err)
+	}
+	var fields []string
+	for _, v := range verr.Violations {
+		if v.Object != "Deployment/jupyter" {
+			t.Errorf("unexpected object: %s", v.Object)
+		}
+		fields = append(fields, v.Field)
+	}
+	expected := []string{
+		"spec.replicas",
+		"spec.template.spec.volumes[0].hostPath",
+		"spec.template.spec.containers[0].securityContext.privileged",
+		"spec.template.spec.containers[0].resources.limits.memory",
+		"spec.template.spec.containers[1].image",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("unexpected violations: %v", fields)
+	}
+
+	err = Check(testManifest, p.For("researchlab"))
+	verr, ok = err.(*ViolationError)
+	if !ok || len(verr.Violations) != 2 {
+		t.Errorf("unexpected violations in the scoped namespace: %v", err)
+	}
+
+	if err := Check(testManifest, Rules{}); err != nil {
+		t.Errorf("violations without rules: %v", err)
+	}
+
+	listed := `
+apiVersion: v1
+kind: List
+items:
+  - apiVersion: v1
+    kind: Pod
+    metadata:
+      name: escape
+    spec:
+      containers:
+        - name: shell
+          image: docker.io/jupyter/minimal-notebook:1.0
+          securityContext:
+            privileged: true
+          resources:
+            limits: {cpu: 100m, memory: 64Mi}
+`
+	err = Check(listed, p.For("default"))
+	if verr, ok := err.(*ViolationError); !ok || len(verr.Violations) != 1 || verr.Violations[0].Object != "Pod/escape" {
+		t.Errorf("the items of the list were not checked: %v", err)
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	for image, repository := range map[string]string{
+		"nginx":                            "docker.io/library/nginx",
+		"jupyter/minimal-notebook:1.0":     "docker.io/jupyter/minimal-notebook",
+		"quay.io/uninett/proxy@sha256:abc": "quay.io/uninett/proxy",
+		"localhost:5000/app:1":             "localhost:5000/app",
+	} {
+		if r := imageRepository(image); r != repository {
+			t.Errorf("unexpected repository of %s: %s", image, r)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package quota
+
+import (
+	"context"
+	"sync"
+)
+
+// Locks serializes the installs in each namespace with a quota, so that
+// concurrent installs can't all pass the quota before any of them is
+// visible in Tiller.
+type Locks struct {
+	mu sync.Mutex
+	// A namespace is locked while its channel holds a value.
+	locks map[string]chan struct{}
+}
+
+func NewLocks() *Locks {
+	return &Locks{locks: make(map[string]chan struct{})}
+}
+
+// Lock the namespace, waiting for the install holding it, or until ctx
+// is done, e.g. as the user gave up on the request. The returned
+// function must be called once the release is installed, or has failed
+// to install.
+func (l *Locks) Lock(ctx context.Context, namespace string) (func(), error) {
+	l.mu.Lock()
+	lock, found := l.locks[namespace]
+	if !found {
+		lock = make(chan struct{}, 1)
+		l.locks[namespace] = lock
+	}
+	l.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
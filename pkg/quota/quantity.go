@@ -0,0 +1,84 @@
+package quota
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"m", 1e-3}, {"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+}
+
+// The largest quantity accepted, in thousandths: a million cores, or a
+// petabyte. Larger quantities are rejected rather than risking overflow
+// when they are summed.
+const maxQuantity = 1e18
+
+// Parse a kubernetes quantity such as 500m, 2 or 512Mi, returning its
+// value in thousandths, so that both millicores and bytes are exact.
+func ParseQuantity(q string) (int64, error) {
+	q = strings.TrimSpace(q)
+	multiplier := 1.0
+	number := q
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(q, s.suffix) {
+			multiplier = s.multiplier
+			number = strings.TrimSuffix(q, s.suffix)
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid quantity %q", q)
+	}
+
+	thousandths := value * multiplier * 1000
+	if thousandths > maxQuantity {
+		return 0, fmt.Errorf("quantity %q is too large", q)
+	}
+	// Ignore the rounding errors of e.g. 0.1 * 1000.
+	if rounded := math.Round(thousandths); math.Abs(thousandths-rounded) < 1e-6 {
+		thousandths = rounded
+	}
+
+	return int64(math.Ceil(thousandths)), nil
+}
+
+// The millicores of a cpu quantity.
+func parseCPU(q string) (int64, error) {
+	return ParseQuantity(q)
+}
+
+// The bytes of a memory quantity.
+func parseMemory(q string) (int64, error) {
+	thousandths, err := ParseQuantity(q)
+	return (thousandths + 999) / 1000, err
+}
+
+// Add value times factor to total, failing instead of overflowing.
+func addTimes(total *int64, value int64, factor int64) error {
+	if value < 0 || factor < 0 {
+		return fmt.Errorf("negative quantity")
+	}
+	if factor != 0 && value > (math.MaxInt64-*total)/factor {
+		return fmt.Errorf("the quantities are too large")
+	}
+	*total += value * factor
+
+	return nil
+}
+
+// The sum of a and b, or the largest int64 if it would overflow.
+func saturatingAdd(a int64, b int64) int64 {
+	if b > math.MaxInt64-a {
+		return math.MaxInt64
+	}
+
+	return a + b
+}
@@ -0,0 +1,209 @@
+// Package quota limits the number of releases, and the resources they
+// request, in a namespace.
+package quota
+
+import (
+	"fmt"
+
+	"github.com/UNINETT/appstore/pkg/manifest"
+)
+
+// The limits of a namespace. Zero, or empty, limits are not enforced.
+type Quota struct {
+	MaxReleases int `json:"maxReleases,omitempty"`
+	// Releases each user may have in the namespace.
+	MaxReleasesPerOwner int `json:"maxReleasesPerOwner,omitempty"`
+	// Releases the users granted access by each subject of the mapping,
+	// e.g. a group of students, may have in the namespace together.
+	MaxReleasesPerGroup int `json:"maxReleasesPerGroup,omitempty"`
+	// The cpu and memory the releases may request in total, as
+	// kubernetes quantities.
+	MaxCPU    string `json:"maxCPU,omitempty"`
+	MaxMemory string `json:"maxMemory,omitempty"`
+}
+
+func (q *Quota) Validate() error {
+	if q.MaxReleases < 0 || q.MaxReleasesPerOwner < 0 || q.MaxReleasesPerGroup < 0 {
+		return fmt.Errorf("negative release limit")
+	}
+	if q.MaxCPU != "" {
+		if _, err := parseCPU(q.MaxCPU); err != nil {
+			return err
+		}
+	}
+	if q.MaxMemory != "" {
+		if _, err := parseMemory(q.MaxMemory); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Whether any of the limits depend on the resources of releases.
+func (q *Quota) LimitsResources() bool {
+	return q != nil && (q.MaxCPU != "" || q.MaxMemory != "")
+}
+
+// The cpu and memory requested by a release.
+type Resources struct {
+	CPUMillis   int64 `json:"cpuMillis"`
+	MemoryBytes int64 `json:"memoryBytes"`
+}
+
+// Sum the cpu and memory requested by the containers of the workloads
+// in a manifest, using the limits of containers without requests like
+// kubernetes does. Replicated workloads count once per replica.
+func ManifestResources(releaseManifest string) (Resources, error) {
+	var total Resources
+	objects, err := manifest.Parse(releaseManifest)
+	if err != nil {
+		return total, err
+	}
+	for _, o := range objects {
+		specPath, found := o.PodSpecPath()
+		if !found {
+			continue
+		}
+		replicas, found := o.Replicas()
+		if !found {
+			replicas = 1
+		}
+		for _, c := range o.List(append(specPath, "containers")...) {
+			container := manifest.AsObject(c)
+			for _, r := range []struct {
+				name  string
+				parse func(string) (int64, error)
+				total *int64
+			}{
+				{"cpu", parseCPU, &total.CPUMillis},
+				{"memory", parseMemory, &total.MemoryBytes},
+			} {
+				q, found := container.Get("resources", "requests", r.name)
+				if !found {
+					q, found = container.Get("resources", "limits", r.name)
+				}
+				if !found {
+					continue
+				}
+				value, err := r.parse(fmt.Sprint(q))
+				if err != nil {
+					return total, fmt.Errorf("%s: %s", o.ID(), err.Error())
+				}
+				if err := addTimes(r.total, value, int64(replicas)); err != nil {
+					return total, fmt.Errorf("%s: %s", o.ID(), err.Error())
+				}
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// A release counted against the quota of its namespace.
+type Release struct {
+	Owner     string
+	Group     string
+	Resources Resources
+}
+
+// What the releases of a namespace use.
+type Usage struct {
+	Releases  int            `json:"releases"`
+	Owners    map[string]int `json:"owners"`
+	Groups    map[string]int `json:"groups"`
+	Resources Resources      `json:"resources"`
+}
+
+func NewUsage(releases []Release) *Usage {
+	u := &Usage{Owners: make(map[string]int), Groups: make(map[string]int)}
+	for _, r := range releases {
+		u.Releases++
+		if r.Owner != "" {
+			u.Owners[r.Owner]++
+		}
+		if r.Group != "" {
+			u.Groups[r.Group]++
+		}
+		u.Resources.CPUMillis = saturatingAdd(u.Resources.CPUMillis, r.Resources.CPUMillis)
+		u.Resources.MemoryBytes = saturatingAdd(u.Resources.MemoryBytes, r.Resources.MemoryBytes)
+	}
+
+	return u
+}
+
+// Installing another release would exceed the quota.
+type ExceededError struct {
+	// The limit exceeded, e.g. maxReleasesPerOwner.
+	Limit   string
+	Message string
+	Usage   *Usage
+	// Whether a resource limit was exceeded, rather than the number of
+	// releases.
+	Resources bool
+}
+
+func (e *ExceededError) Error() string {
+	return "quota exceeded: " + e.Message
+}
+
+// Check that the owner may install another release, given by the
+// subject group.
+func (q *Quota) CheckReleases(u *Usage, owner string, group string) error {
+	if q == nil {
+		return nil
+	}
+	checks := []struct {
+		limit   string
+		max     int
+		current int
+		message string
+	}{
+		{"maxReleases", q.MaxReleases, u.Releases, "the namespace has %d of %d releases"},
+		{"maxReleasesPerOwner", q.MaxReleasesPerOwner, u.Owners[owner], "you have %d of %d releases in the namespace"},
+		{"maxReleasesPerGroup", q.MaxReleasesPerGroup, u.Groups[group], "the members of " + group + " have %d of %d releases in the namespace"},
+	}
+	for _, c := range checks {
+		if c.max > 0 && c.current >= c.max {
+			return &ExceededError{Limit: c.limit, Message: fmt.Sprintf(c.message, c.current, c.max), Usage: u}
+		}
+	}
+
+	return nil
+}
+
+// Check that a release requesting the given resources fits in the
+// quota.
+func (q *Quota) CheckResources(u *Usage, requested Resources) error {
+	if q == nil {
+		return nil
+	}
+	if q.MaxCPU != "" {
+		max, err := parseCPU(q.MaxCPU)
+		if err != nil {
+			return err
+		}
+		if requested.CPUMillis > max-u.Resources.CPUMillis {
+			return &ExceededError{Limit: "maxCPU", Message: fmt.Sprintf("the release requests %dm cpu, but only %dm of %s are left", requested.CPUMillis, remaining(max, u.Resources.CPUMillis), q.MaxCPU), Usage: u, Resources: true}
+		}
+	}
+	if q.MaxMemory != "" {
+		max, err := parseMemory(q.MaxMemory)
+		if err != nil {
+			return err
+		}
+		if requested.MemoryBytes > max-u.Resources.MemoryBytes {
+			return &ExceededError{Limit: "maxMemory", Message: fmt.Sprintf("the release requests %d bytes of memory, but only %d of %s are left", requested.MemoryBytes, remaining(max, u.Resources.MemoryBytes), q.MaxMemory), Usage: u, Resources: true}
+		}
+	}
+
+	return nil
+}
+
+func remaining(max int64, used int64) int64 {
+	if used > max {
+		return 0
+	}
+
+	return max - used
+}
@@ -0,0 +1,158 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const testManifest = `
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: jupyter
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+        - name: notebook
+          resources:
+            requests:
+              cpu: 250m
+              memory: 256Mi
+            limits:
+              cpu: "1"
+              memory: 1Gi
+        - name: proxy
+          resources:
+            limits:
+              cpu: 0.1
+              memory: 64Mi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: jupyter
+`
+
+func TestParseQuantity(t *testing.T) {
+	for q, expected := range map[string]int64{"500m": 500, "2": 2000, "0.1": 100, "1Ki": 1024000, "1k": 1000000} {
+		if v, err := ParseQuantity(q); err != nil || v != expected {
+			t.Errorf("unexpected value of %s: %d, %v", q, v, err)
+		}
+	}
+	for _, q := range []string{"lots", "10Pi", "1e30"} {
+		if _, err := ParseQuantity(q); err == nil {
+			t.Errorf("invalid quantity %s accepted", q)
+		}
+	}
+}
+
+func TestManifestResourcesOverflow(t *testing.T) {
+	overflowing := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: huge
+spec:
+  replicas: 100000
+  template:
+    spec:
+      containers:
+        - name: huge
+          resources:
+            requests:
+              memory: 800Ti
+`
+	if r, err := ManifestResources(overflowing); err == nil {
+		t.Errorf("the overflowing resources were accepted: %v", r)
+	}
+}
+
+func TestManifestResources(t *testing.T) {
+	r, err := ManifestResources(testManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CPUMillis != 700 || r.MemoryBytes != 2*(256+64)<<20 {
+		t.Errorf("unexpected resources: %v", r)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	q := &Quota{MaxReleases: 3, MaxReleasesPerOwner: 1, MaxReleasesPerGroup: 2, MaxCPU: "1", MaxMemory: "1Gi"}
+	if err := q.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	u := NewUsage([]Release{
+		{Owner: "alice", Group: "fc:adhoc:students", Resources: Resources{CPUMillis: 500, MemoryBytes: 512 << 20}},
+		{Owner: "bob", Group: "fc:adhoc:students"},
+	})
+
+	if err := q.CheckReleases(u, "carol", "fc:org:uninett.no"); err != nil {
+		t.Errorf("release within the quota rejected: %s", err.Error())
+	}
+	for owner, limit := range map[string]string{"alice": "maxReleasesPerOwner", "carol": "maxReleasesPerGroup"} {
+		err := q.CheckReleases(u, owner, "fc:adhoc:students")
+		if e, ok := err.(*ExceededError); !ok || e.Limit != limit {
+			t.Errorf("expected %s to be exceeded for %s, got %v", limit, owner, err)
+		}
+	}
+
+	if err := q.CheckResources(u, Resources{CPUMillis: 500, MemoryBytes: 512 << 20}); err != nil {
+		t.Errorf("resources within the quota rejected: %s", err.Error())
+	}
+	err := q.CheckResources(u, Resources{CPUMillis: 600})
+	if e, ok := err.(*ExceededError); !ok || e.Limit != "maxCPU" || !e.Resources {
+		t.Errorf("expected maxCPU to be exceeded, got %v", err)
+	}
+}
+
+func mustLock(t *testing.T, locks *Locks, namespace string) func() {
+	unlock, err := locks.Lock(context.Background(), namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return unlock
+}
+
+func TestLocks(t *testing.T) {
+	locks := NewLocks()
+	unlock := mustLock(t, locks, "researchlab")
+	mustLock(t, locks, "other")()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, _ := locks.Lock(context.Background(), "researchlab")
+		unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the namespace was locked twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("the namespace was not unlocked")
+	}
+}
+
+func TestLockCanceled(t *testing.T) {
+	locks := NewLocks()
+	unlock := mustLock(t, locks, "researchlab")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locks.Lock(ctx, "researchlab"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait to time out, got %v", err)
+	}
+	// Giving up leaves the lock to its holder.
+	unlock()
+	mustLock(t, locks, "researchlab")()
+}
@@ -0,0 +1,85 @@
+// Package ratelimit limits how many requests a client may make, with
+// separate budgets for reading and for changing things.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// The budgets requests are taken from.
+const (
+	BudgetRead  = "read"
+	BudgetWrite = "write"
+)
+
+// Allow Requests per Per, in bursts of up to Requests. Requests are not
+// limited when Requests is 0.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Requests replenished per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// The outcome of taking a request from a budget.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// How long until the request would be allowed, when it is not.
+	RetryAfter time.Duration
+	// How long until the whole budget is available again.
+	Reset time.Duration
+}
+
+// Where the remaining budgets of the clients are kept.
+type Store interface {
+	// Take a request from the budget of key, unless it is used up.
+	Take(key string, limit Limit) (Result, error)
+}
+
+// Limits the requests of clients, taking reads and writes from separate
+// budgets.
+type Limiter struct {
+	store Store
+	read  Limit
+	write Limit
+}
+
+func NewLimiter(store Store, read Limit, write Limit) *Limiter {
+	return &Limiter{store: store, read: read, write: write}
+}
+
+// The budget of requests made with method.
+func Budget(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return BudgetRead
+	default:
+		return BudgetWrite
+	}
+}
+
+// Take a request made with method from the budget of client. Requests
+// are allowed with a Limit of 0 when the budget is not limited.
+func (l *Limiter) Take(client string, method string) (Result, error) {
+	budget := Budget(method)
+	limit := l.read
+	if budget == BudgetWrite {
+		limit = l.write
+	}
+	if limit.Requests == 0 {
+		return Result{Allowed: true}, nil
+	}
+
+	return l.store.Take(budget+":"+client, limit)
+}
+
+// Round d up to whole seconds, as used in the Retry-After header.
+func Seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limiter := NewLimiter(store, Limit{}, Limit{Requests: 2, Per: time.Minute})
+
+	for i := 0; i < 10; i++ {
+		if res, _ := limiter.Take("user:a", "GET"); !res.Allowed || res.Limit != 0 {
+			t.Fatalf("the unlimited read budget was limited: %+v", res)
+		}
+	}
+
+	for remaining := 1; remaining >= 0; remaining-- {
+		res, _ := limiter.Take("user:a", "POST")
+		if !res.Allowed || res.Limit != 2 || res.Remaining != remaining {
+			t.Fatalf("unexpected result within the budget: %+v", res)
+		}
+	}
+	res, _ := limiter.Take("user:a", "DELETE")
+	if res.Allowed {
+		t.Fatal("the request was allowed although the budget was used up")
+	}
+	if res.RetryAfter != 30*time.Second || res.Reset != time.Minute {
+		t.Errorf("unexpected retry after %s and reset %s", res.RetryAfter, res.Reset)
+	}
+	if res, _ := limiter.Take("user:b", "POST"); !res.Allowed {
+		t.Error("the budget of another client was used")
+	}
+
+	now = now.Add(30 * time.Second)
+	if res, _ := limiter.Take("user:a", "PATCH"); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("the budget was not replenished: %+v", res)
+	}
+
+	now = now.Add(2 * time.Minute)
+	limiter.Take("user:a", "POST")
+	if len(store.buckets) != 1 {
+		t.Errorf("the full buckets were not dropped: %d left", len(store.buckets))
+	}
+}
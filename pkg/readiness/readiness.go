@@ -0,0 +1,80 @@
+// Package readiness runs the checks deciding whether the server is ready
+// to handle requests.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A check of something the server depends on.
+type Check struct {
+	Name string
+	// Returns why the check failed, or nil. Checks that don't take ctx
+	// into account are given up on when it is done.
+	Run func(ctx context.Context) error
+}
+
+// The outcome of a check.
+type Result struct {
+	Name      string  `json:"name"`
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// The outcome of all the checks. The server is ready when all of them
+// passed.
+type Report struct {
+	Ready  bool      `json:"ready"`
+	Checks []*Result `json:"checks"`
+}
+
+func run(ctx context.Context, check Check) *Result {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("gave up after %s: %s", time.Since(start), ctx.Err().Error())
+	}
+
+	res := &Result{
+		Name:      check.Name,
+		OK:        err == nil,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// Run the checks concurrently, giving each at most timeout.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) *Report {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make([]chan *Result, len(checks))
+	for i, check := range checks {
+		results[i] = make(chan *Result, 1)
+		go func(check Check, result chan<- *Result) {
+			result <- run(ctx, check)
+		}(check, results[i])
+	}
+
+	report := &Report{Ready: true, Checks: make([]*Result, len(checks))}
+	for i, result := range results {
+		report.Checks[i] = <-result
+		report.Ready = report.Ready && report.Checks[i].OK
+	}
+
+	return report
+}
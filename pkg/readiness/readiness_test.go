@@ -0,0 +1,44 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	checks := []Check{
+		{Name: "ok", Run: func(ctx context.Context) error { return nil }},
+		{Name: "failing", Run: func(ctx context.Context) error { return fmt.Errorf("down") }},
+		{Name: "hanging", Run: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	}
+
+	start := time.Now()
+	report := Run(context.Background(), checks, 20*time.Millisecond)
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("the checks were not given up on after the timeout, took %s", took)
+	}
+	if report.Ready {
+		t.Error("ready although checks failed")
+	}
+	if len(report.Checks) != 3 {
+		t.Fatalf("unexpected results: %v", report.Checks)
+	}
+	for i, ok := range []bool{true, false, false} {
+		if res := report.Checks[i]; res.Name != checks[i].Name || res.OK != ok {
+			t.Errorf("unexpected result of %s: %+v", checks[i].Name, res)
+		}
+	}
+	if report.Checks[1].Error != "down" {
+		t.Errorf("unexpected error: %s", report.Checks[1].Error)
+	}
+
+	report = Run(context.Background(), checks[:1], time.Second)
+	if !report.Ready {
+		t.Errorf("not ready although all checks passed: %+v", report.Checks[0])
+	}
+}
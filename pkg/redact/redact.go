@@ -0,0 +1,156 @@
+// Package redact masks secrets in release values and manifests before
+// they are returned to users.
+package redact
+
+import (
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// What secrets are replaced with.
+const Mask = "********"
+
+// The paths redacted by default. Paths are dotted keys, where * matches
+// a single key and ** any number of keys.
+var DefaultPaths = []string{
+	"secrets.*",
+	"**.password",
+	"**.token",
+	"**.client_secret",
+}
+
+// Redactor masks the values at a set of paths.
+type Redactor struct {
+	paths [][]string
+}
+
+func NewRedactor(paths []string) *Redactor {
+	r := &Redactor{}
+	return r.With(paths...)
+}
+
+// A redactor masking the given paths in addition to those of r, e.g.
+// the paths a chart marks as sensitive.
+func (r *Redactor) With(paths ...string) *Redactor {
+	combined := &Redactor{paths: append([][]string{}, r.paths...)}
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			combined.paths = append(combined.paths, strings.Split(p, "."))
+		}
+	}
+
+	return combined
+}
+
+func matchPath(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 || (pattern[0] != "*" && pattern[0] != path[0]) {
+		return false
+	}
+
+	return matchPath(pattern[1:], path[1:])
+}
+
+func (r *Redactor) sensitive(path []string) bool {
+	for _, p := range r.paths {
+		if matchPath(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the value at path is masked, as it or one of the maps it is
+// in is at a sensitive path.
+func (r *Redactor) Sensitive(path []string) bool {
+	for i := 1; i <= len(path); i++ {
+		if r.sensitive(path[:i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return a copy of values with every value at a sensitive path, and
+// everything below it, masked. Lists don't add to the path.
+func (r *Redactor) Values(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	return r.redact(values, nil, false).(map[string]interface{})
+}
+
+func (r *Redactor) redact(v interface{}, path []string, masked bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, nested := range v {
+			nestedPath := append(append([]string{}, path...), k)
+			c[k] = r.redact(nested, nestedPath, masked || r.sensitive(nestedPath))
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, nested := range v {
+			c[i] = r.redact(nested, path, masked)
+		}
+		return c
+	}
+	if masked && v != nil {
+		return Mask
+	}
+
+	return v
+}
+
+// Redact a YAML document of values, as stored by Tiller.
+func (r *Redactor) RawValues(raw string) (string, error) {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal([]byte(raw), &values); err != nil {
+		return "", err
+	}
+	redacted, err := yaml.Marshal(r.Values(values))
+
+	return string(redacted), err
+}
+
+// Mask the data of the Secrets in a release manifest. Other resources
+// are left as they are.
+func Manifest(manifest string) string {
+	docs := strings.Split(manifest, "\n---")
+	for i, doc := range docs {
+		var resource map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &resource); err != nil || resource["kind"] != "Secret" {
+			continue
+		}
+		for _, key := range []string{"data", "stringData"} {
+			if data, ok := resource[key].(map[string]interface{}); ok {
+				for k := range data {
+					data[k] = Mask
+				}
+			}
+		}
+		redacted, err := yaml.Marshal(resource)
+		if err != nil {
+			docs[i] = ""
+			continue
+		}
+		docs[i] = "\n" + string(redacted)
+	}
+
+	return strings.Join(docs, "\n---")
+}
@@ -0,0 +1,58 @@
+package redact
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	r := NewRedactor(DefaultPaths).With("db.dsn")
+	values := map[string]interface{}{
+		"secrets":  map[string]interface{}{"api": "s3cr3t", "nested": map[string]interface{}{"key": "k"}},
+		"db":       map[string]interface{}{"dsn": "postgres://u:p@db", "host": "db"},
+		"users":    []interface{}{map[string]interface{}{"name": "a", "password": "pw"}},
+		"token":    "t",
+		"replicas": 2,
+	}
+	expected := map[string]interface{}{
+		"secrets":  map[string]interface{}{"api": Mask, "nested": map[string]interface{}{"key": Mask}},
+		"db":       map[string]interface{}{"dsn": Mask, "host": "db"},
+		"users":    []interface{}{map[string]interface{}{"name": "a", "password": Mask}},
+		"token":    Mask,
+		"replicas": 2,
+	}
+
+	if redacted := r.Values(values); !reflect.DeepEqual(redacted, expected) {
+		t.Errorf("unexpected values: %v", redacted)
+	}
+	if values["token"] != "t" {
+		t.Errorf("the values were modified")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	manifest := `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: jupyter
+data:
+  password: c2VjcmV0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: jupyter
+data:
+  password: visible
+`
+	redacted := Manifest(manifest)
+	if strings.Contains(redacted, "c2VjcmV0") {
+		t.Errorf("the secret was not masked: %s", redacted)
+	}
+	if !strings.Contains(redacted, "visible") {
+		t.Errorf("the config map was masked: %s", redacted)
+	}
+}
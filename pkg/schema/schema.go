@@ -0,0 +1,114 @@
+// Package schema validates the values of releases against JSON schemas,
+// either shipped with the chart or kept in a registry by the appstore.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The file in a chart holding the schema of its values.
+const ChartSchemaFile = "values.schema.json"
+
+// A value not matching the schema.
+type FieldError struct {
+	// Dotted path of the value, or (root) for the values themselves. Items
+	// of lists are given by their index, as in ports.0.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// The field of errors about the values themselves.
+const rootField = "(root)"
+
+// The values do not match the schema.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+
+	return "invalid values: " + strings.Join(messages, "; ")
+}
+
+// Validate values against schema. Returns a *ValidationError if the
+// values do not match, and other errors if the schema is invalid.
+func Validate(schema []byte, values map[string]interface{}) error {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	// Round trip the values through JSON, so that numbers are float64
+	// whatever type YAML decoding gave them.
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	v, err := newValidator(schema)
+	if err != nil {
+		return fmt.Errorf("invalid values schema: %s", err.Error())
+	}
+	if err := v.validate(v.root, rootField, doc, 0); err != nil {
+		return fmt.Errorf("invalid values schema: %s", err.Error())
+	}
+	if len(v.errors) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: v.errors}
+}
+
+// Registry holds schemas for charts which do not have one, as files
+// named <chart>-<version>.schema.json or <chart>.schema.json in a
+// directory. The versioned schema is preferred.
+type Registry struct {
+	dir string
+}
+
+// A registry of the schemas in dir. An empty dir gives a registry
+// without any schemas.
+func NewRegistry(dir string) *Registry {
+	return &Registry{dir: dir}
+}
+
+// The schema of the chart with the given name and version, if the
+// registry has one.
+func (r *Registry) Lookup(name string, version string) ([]byte, bool, error) {
+	if r == nil || r.dir == "" {
+		return nil, false, nil
+	}
+	// The names come from the charts, but should not escape the
+	// registry anyway.
+	if strings.ContainsAny(name+version, `/\`) {
+		return nil, false, nil
+	}
+
+	candidates := []string{name + ".schema.json"}
+	if version != "" {
+		candidates = append([]string{name + "-" + version + ".schema.json"}, candidates...)
+	}
+	for _, c := range candidates {
+		data, err := ioutil.ReadFile(filepath.Join(r.dir, c))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return data, true, nil
+	}
+
+	return nil, false, nil
+}
@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["ingress"],
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "ingress": {
+      "type": "object",
+      "properties": {"host": {"type": "string"}}
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	values := map[string]interface{}{
+		"replicas": 2,
+		"ingress":  map[string]interface{}{"host": "jupyter.example.org"},
+	}
+	if err := Validate([]byte(testSchema), values); err != nil {
+		t.Errorf("valid values rejected: %s", err.Error())
+	}
+
+	values = map[string]interface{}{
+		"replicas": 0,
+		"ingress":  map[string]interface{}{"host": 42},
+	}
+	err := Validate([]byte(testSchema), values)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = true
+	}
+	if !fields["replicas"] || !fields["ingress.host"] || len(verr.Errors) != 2 {
+		t.Errorf("unexpected errors: %v", verr.Errors)
+	}
+
+	if err := Validate([]byte(testSchema), nil); err == nil {
+		t.Errorf("missing required value accepted")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "jupyter.schema.json"), []byte("{}"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "jupyter-1.0.0.schema.json"), []byte(testSchema), 0644)
+
+	r := NewRegistry(dir)
+	if s, found, _ := r.Lookup("jupyter", "1.0.0"); !found || string(s) != testSchema {
+		t.Errorf("the versioned schema was not used")
+	}
+	if s, found, _ := r.Lookup("jupyter", "0.9.0"); !found || string(s) != "{}" {
+		t.Errorf("the unversioned schema was not used")
+	}
+	if _, found, _ := r.Lookup("nginx", ""); found {
+		t.Errorf("found a schema of an unknown chart")
+	}
+	if _, found, _ := r.Lookup("../jupyter", ""); found {
+		t.Errorf("found a schema outside the registry")
+	}
+}
+
+func TestValidateKeywords(t *testing.T) {
+	s := `{
+	  "definitions": {
+	    "port": {"type": "integer", "minimum": 1, "exclusiveMaximum": 65536}
+	  },
+	  "type": "object",
+	  "additionalProperties": false,
+	  "properties": {
+	    "ports": {"type": "array", "items": {"$ref": "#/definitions/port"}, "uniqueItems": true},
+	    "size": {"enum": ["small", "large"]},
+	    "name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8},
+	    "storage": {"anyOf": [{"type": "null"}, {"type": "string", "minLength": 1}]}
+	  }
+	}`
+
+	valid := map[string]interface{}{
+		"ports":   []interface{}{80, 443},
+		"size":    "small",
+		"name":    "jupyter",
+		"storage": nil,
+	}
+	if err := Validate([]byte(s), valid); err != nil {
+		t.Errorf("valid values rejected: %s", err.Error())
+	}
+
+	invalid := map[string]interface{}{
+		"ports":   []interface{}{80, 65536, 80},
+		"size":    "medium",
+		"name":    "Jupyter",
+		"storage": "",
+		"extra":   true,
+	}
+	err := Validate([]byte(s), invalid)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	fields := make(map[string]int)
+	for _, fe := range verr.Errors {
+		fields[fe.Field]++
+	}
+	expected := map[string]int{"(root)": 1, "ports": 1, "ports.1": 1, "size": 1, "name": 1, "storage": 1}
+	if len(fields) != len(expected) {
+		t.Errorf("unexpected errors: %v", verr.Errors)
+	}
+	for f, n := range expected {
+		if fields[f] != n {
+			t.Errorf("expected %d errors for %s, got %v", n, f, verr.Errors)
+		}
+	}
+
+	for _, broken := range []string{`{"$ref": "other.json"}`, `{"$ref": "#"}`, `{"pattern": "("}`, `[`} {
+		if err := Validate([]byte(broken), map[string]interface{}{"name": "x"}); err == nil {
+			t.Errorf("invalid schema %s accepted", broken)
+		} else if _, invalid := err.(*ValidationError); invalid {
+			t.Errorf("invalid schema %s reported as invalid values: %s", broken, err.Error())
+		}
+	}
+}
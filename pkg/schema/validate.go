@@ -0,0 +1,496 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// How deep references may be followed without descending into the
+// values, so that a schema referring to itself fails instead of looping.
+const maxRefDepth = 64
+
+// The keywords of a JSON schema (draft 4 to 7) used for validation.
+// Annotations such as format and title are ignored, as are the
+// keywords not listed here.
+type jsonSchema struct {
+	// false schemas reject any value, true schemas are empty.
+	never bool
+
+	Ref                  string                 `json:"$ref"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+	Type                 interface{}            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                *json.RawMessage       `json:"const"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	MinProperties        *int                   `json:"minProperties"`
+	MaxProperties        *int                   `json:"maxProperties"`
+	Items                *jsonSchema            `json:"-"`
+	TupleItems           []*jsonSchema          `json:"-"`
+	AdditionalItems      *jsonSchema            `json:"additionalItems"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	UniqueItems          bool                   `json:"uniqueItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     interface{}            `json:"exclusiveMinimum"`
+	ExclusiveMaximum     interface{}            `json:"exclusiveMaximum"`
+	MultipleOf           *float64               `json:"multipleOf"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Not                  *jsonSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = jsonSchema{}
+		return nil
+	case "false":
+		*s = jsonSchema{never: true}
+		return nil
+	}
+
+	type plain jsonSchema
+	var raw struct {
+		*plain
+		Items json.RawMessage `json:"items"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if s.Pattern != "" {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %s", s.Pattern, err.Error())
+		}
+		s.pattern = p
+	}
+	items := bytes.TrimSpace(raw.Items)
+	if len(items) > 0 && items[0] == '[' {
+		return json.Unmarshal(items, &s.TupleItems)
+	}
+	if len(items) > 0 {
+		s.Items = new(jsonSchema)
+		return json.Unmarshal(items, s.Items)
+	}
+
+	return nil
+}
+
+// A schema being validated against, with the document it is part of to
+// resolve references in.
+type validator struct {
+	root   *jsonSchema
+	doc    interface{}
+	refs   map[string]*jsonSchema
+	errors []FieldError
+}
+
+func newValidator(schema []byte) (*validator, error) {
+	v := &validator{root: new(jsonSchema), refs: make(map[string]*jsonSchema)}
+	if err := json.Unmarshal(schema, v.root); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(schema, &v.doc); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// The schema $ref refers to. Only references within the schema, as JSON
+// pointers such as #/definitions/host, are supported.
+func (v *validator) resolve(ref string) (*jsonSchema, error) {
+	if s, ok := v.refs[ref]; ok {
+		return s, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s, only references within the schema are supported", ref)
+	}
+
+	node := v.doc
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			node = n[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("unresolvable reference %s", ref)
+			}
+			node = n[i]
+		default:
+			node = nil
+		}
+		if node == nil {
+			return nil, fmt.Errorf("unresolvable reference %s", ref)
+		}
+	}
+
+	raw, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	s := new(jsonSchema)
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, fmt.Errorf("invalid reference %s: %s", ref, err.Error())
+	}
+	v.refs[ref] = s
+
+	return s, nil
+}
+
+func (v *validator) fail(field string, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Whether value, at field, matches s, without recording the errors.
+func (v *validator) matches(s *jsonSchema, field string, value interface{}, depth int) (bool, error) {
+	saved := v.errors
+	v.errors = nil
+	err := v.validate(s, field, value, depth)
+	matched := len(v.errors) == 0
+	v.errors = saved
+
+	return matched, err
+}
+
+// Record the ways value, at field, does not match s. depth counts the
+// references followed since descending into value. Errors are only
+// returned for invalid schemas.
+func (v *validator) validate(s *jsonSchema, field string, value interface{}, depth int) error {
+	if s.never {
+		v.fail(field, "False always fails validation")
+		return nil
+	}
+	if s.Ref != "" {
+		// Other keywords are ignored next to $ref before draft 2019-09.
+		if depth >= maxRefDepth {
+			return fmt.Errorf("%s refers to itself", s.Ref)
+		}
+		target, err := v.resolve(s.Ref)
+		if err != nil {
+			return err
+		}
+		return v.validate(target, field, value, depth+1)
+	}
+
+	if types := s.types(); len(types) > 0 && !hasType(types, value) {
+		v.fail(field, "Invalid type. Expected: %s, given: %s", strings.Join(types, "/"), typeOf(value))
+		return nil
+	}
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			allowed[i] = string(b)
+		}
+		v.fail(field, "%s must be one of the following: %s", lastField(field), strings.Join(allowed, ", "))
+	}
+	if s.Const != nil {
+		var c interface{}
+		if err := json.Unmarshal(*s.Const, &c); err != nil {
+			return err
+		}
+		if !equal(c, value) {
+			v.fail(field, "%s does not match: %s", lastField(field), string(*s.Const))
+		}
+	}
+
+	var err error
+	switch value := value.(type) {
+	case map[string]interface{}:
+		err = v.validateObject(s, field, value)
+	case []interface{}:
+		err = v.validateArray(s, field, value)
+	case string:
+		v.validateString(s, field, value)
+	case float64:
+		v.validateNumber(s, field, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range s.AllOf {
+		if err := v.validate(sub, field, value, depth); err != nil {
+			return err
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, sub := range s.AnyOf {
+			ok, err := v.matches(sub, field, value, depth)
+			if err != nil {
+				return err
+			}
+			if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(field, "Must validate at least one schema (anyOf)")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, sub := range s.OneOf {
+			ok, err := v.matches(sub, field, value, depth)
+			if err != nil {
+				return err
+			}
+			if ok {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(field, "Must validate one and only one schema (oneOf)")
+		}
+	}
+	if s.Not != nil {
+		ok, err := v.matches(s.Not, field, value, depth)
+		if err != nil {
+			return err
+		}
+		if ok {
+			v.fail(field, "Must not validate the schema (not)")
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateObject(s *jsonSchema, field string, value map[string]interface{}) error {
+	for _, r := range s.Required {
+		if _, ok := value[r]; !ok {
+			v.fail(field, "%s is required", r)
+		}
+	}
+	if s.MinProperties != nil && len(value) < *s.MinProperties {
+		v.fail(field, "Must have at least %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(value) > *s.MaxProperties {
+		v.fail(field, "Must have at most %d properties", *s.MaxProperties)
+	}
+
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub, ok := s.Properties[k]
+		if !ok {
+			sub = s.AdditionalProperties
+		}
+		if sub == nil {
+			continue
+		}
+		if sub.never && !ok {
+			v.fail(field, "Additional property %s is not allowed", k)
+			continue
+		}
+		if err := v.validate(sub, childField(field, k), value[k], 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateArray(s *jsonSchema, field string, value []interface{}) error {
+	if s.MinItems != nil && len(value) < *s.MinItems {
+		v.fail(field, "Array must have at least %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(value) > *s.MaxItems {
+		v.fail(field, "Array must have at most %d items", *s.MaxItems)
+	}
+	if s.UniqueItems {
+	unique:
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					v.fail(field, "array items[%d,%d] must be unique", i, j)
+					break unique
+				}
+			}
+		}
+	}
+
+	for i, item := range value {
+		sub := s.Items
+		if s.TupleItems != nil {
+			sub = s.AdditionalItems
+			if i < len(s.TupleItems) {
+				sub = s.TupleItems[i]
+			} else if sub != nil && sub.never {
+				v.fail(field, "No additional items allowed on array")
+				break
+			}
+		}
+		if sub == nil {
+			continue
+		}
+		if err := v.validate(sub, childField(field, strconv.Itoa(i)), item, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) validateString(s *jsonSchema, field string, value string) {
+	length := utf8.RuneCountInString(value)
+	if s.MinLength != nil && length < *s.MinLength {
+		v.fail(field, "String length must be greater than or equal to %d", *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.fail(field, "String length must be less than or equal to %d", *s.MaxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		v.fail(field, "Does not match pattern '%s'", s.Pattern)
+	}
+}
+
+func (v *validator) validateNumber(s *jsonSchema, field string, value float64) {
+	// Draft 4 marks the minimum and maximum exclusive with booleans,
+	// later drafts give the exclusive bounds as numbers.
+	exclusive := func(bound interface{}, limit *float64) (*float64, bool) {
+		switch b := bound.(type) {
+		case bool:
+			return limit, b
+		case float64:
+			return &b, true
+		}
+		return limit, false
+	}
+
+	if min, excl := exclusive(s.ExclusiveMinimum, s.Minimum); min != nil {
+		if excl && value <= *min {
+			v.fail(field, "Must be greater than %s", formatNumber(*min))
+		} else if !excl && value < *min {
+			v.fail(field, "Must be greater than or equal to %s", formatNumber(*min))
+		}
+	}
+	if _, isNumber := s.ExclusiveMinimum.(float64); isNumber && s.Minimum != nil && value < *s.Minimum {
+		v.fail(field, "Must be greater than or equal to %s", formatNumber(*s.Minimum))
+	}
+	if max, excl := exclusive(s.ExclusiveMaximum, s.Maximum); max != nil {
+		if excl && value >= *max {
+			v.fail(field, "Must be less than %s", formatNumber(*max))
+		} else if !excl && value > *max {
+			v.fail(field, "Must be less than or equal to %s", formatNumber(*max))
+		}
+	}
+	if _, isNumber := s.ExclusiveMaximum.(float64); isNumber && s.Maximum != nil && value > *s.Maximum {
+		v.fail(field, "Must be less than or equal to %s", formatNumber(*s.Maximum))
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		if q := value / *s.MultipleOf; math.Abs(q-math.Floor(q+0.5)) > 1e-9 {
+			v.fail(field, "Must be a multiple of %s", formatNumber(*s.MultipleOf))
+		}
+	}
+}
+
+// The types allowed by the schema, none meaning any type.
+func (s *jsonSchema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+
+	return nil
+}
+
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+
+	return "object"
+}
+
+func hasType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// The dotted path of key in field, (root) being the values themselves.
+func childField(field string, key string) string {
+	if field == rootField {
+		return key
+	}
+
+	return field + "." + key
+}
+
+func lastField(field string) string {
+	return field[strings.LastIndex(field, ".")+1:]
+}
@@ -17,11 +17,15 @@ limitations under the License.
 package search
 
 import (
+	"time"
+
 	"github.com/Sirupsen/logrus"
 
 	"k8s.io/helm/cmd/helm/search"
 	helm_env "k8s.io/helm/pkg/helm/environment"
 	"k8s.io/helm/pkg/repo"
+
+	"github.com/UNINETT/appstore/pkg/metrics"
 )
 
 // searchMaxScore suggests that any score higher than this is not considered a match.
@@ -36,6 +40,7 @@ func ensureIndex(settings *helm_env.EnvSettings, logger *logrus.Entry) error {
 		if err != nil {
 			return err
 		}
+		metrics.SetSearchIndex(len(index.All()), time.Now())
 	}
 
 	return nil
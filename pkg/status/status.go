@@ -17,6 +17,7 @@ limitations under the License.
 package status
 
 import (
+	"context"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"github.com/UNINETT/appstore/pkg/helmutil"
@@ -27,8 +28,8 @@ import (
 	"k8s.io/helm/pkg/proto/hapi/services"
 )
 
-func GetAllReleases(settings *helm_env.EnvSettings, logger *logrus.Entry) ([]*release.Release, error) {
-	client := helmutil.InitHelmClient(settings)
+func GetAllReleases(ctx context.Context, settings *helm_env.EnvSettings, logger *logrus.Entry) ([]*release.Release, error) {
+	client := helmutil.InitHelmClient(ctx, settings)
 	sortBy := services.ListSort_NAME
 	sortOrder := services.ListSort_ASC
 
@@ -0,0 +1,323 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Spans are exported in batches of up to maxBatch spans, at least every
+// batchInterval. Spans ended while queueSize spans are waiting to be
+// exported are dropped.
+const (
+	maxBatch      = 512
+	batchInterval = 5 * time.Second
+	queueSize     = 2048
+	exportTimeout = 30 * time.Second
+)
+
+const serviceName = "appstore"
+
+// An ended span, as exported.
+type spanRecord struct {
+	TraceID    string                 `json:"traceId"`
+	SpanID     string                 `json:"spanId"`
+	ParentID   string                 `json:"parentSpanId,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       int                    `json:"-"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+func (s *Span) record() spanRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := spanRecord{
+		TraceID: s.traceID.String(),
+		SpanID:  s.spanID.String(),
+		Name:    s.name,
+		Kind:    s.kind,
+		Start:   s.start,
+		End:     s.end,
+		Error:   s.err,
+	}
+	if s.parent != (spanID{}) {
+		r.ParentID = s.parent.String()
+	}
+	if len(s.attrs) > 0 {
+		r.Attributes = make(map[string]interface{}, len(s.attrs))
+		for _, a := range s.attrs {
+			r.Attributes[a.Key] = a.Value
+		}
+	}
+
+	return r
+}
+
+type spanExporter interface {
+	exportSpans(ctx context.Context, spans []spanRecord) error
+}
+
+// Creates spans, and exports the sampled ones in the background. The
+// zero tracer samples nothing.
+type tracer struct {
+	ratio    float64
+	exporter spanExporter
+	queue    chan spanRecord
+	stop     chan struct{}
+	done     chan struct{}
+	logger   *logrus.Entry
+}
+
+var (
+	globalMu sync.RWMutex
+	global   = &tracer{}
+)
+
+func currentTracer() *tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
+
+func setTracer(t *tracer) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	global = t
+}
+
+func newTracer(e spanExporter, ratio float64) *tracer {
+	t := &tracer{
+		ratio:    ratio,
+		exporter: e,
+		queue:    make(chan spanRecord, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		logger:   logrus.WithFields(logrus.Fields{"namespace": "tracing"}),
+	}
+	go t.run()
+
+	return t
+}
+
+func (t *tracer) start(ctx context.Context, name string, kind int, attrs []Attribute) (context.Context, *Span) {
+	s := &Span{kind: kind, start: time.Now(), tracer: t, name: name, attrs: attrs}
+	s.spanID = newSpanID()
+	if parent := spanFromContext(ctx); parent != nil {
+		// Spans within a request follow the decision for the request.
+		s.traceID, s.parent, s.sampled, s.tracer = parent.traceID, parent.spanID, parent.sampled, parent.tracer
+	} else if remote, ok := ctx.Value(remoteKey).(spanContext); ok {
+		s.traceID, s.parent = remote.traceID, remote.spanID
+		s.sampled = t.exporter != nil && sample(t.ratio)
+	} else {
+		s.traceID = newTraceID()
+		s.sampled = t.exporter != nil && sample(t.ratio)
+	}
+
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+func (t *tracer) export(s *Span) {
+	if t.exporter == nil {
+		return
+	}
+	select {
+	case t.queue <- s.record():
+	default:
+		t.logger.Debugf("Dropped span %s, %d spans are waiting to be exported", s.name, queueSize)
+	}
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []spanRecord
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.exportSpans(ctx, batch); err != nil {
+			t.logger.Warnf("Failed to export %d spans: %s", len(batch), err.Error())
+		}
+		batch = nil
+	}
+	add := func(r spanRecord) {
+		batch = append(batch, r)
+		if len(batch) >= maxBatch {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case r := <-t.queue:
+			add(r)
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case r := <-t.queue:
+					add(r)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Export the spans ended so far, and stop exporting.
+func (t *tracer) shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	close(t.stop)
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Writes the spans as JSON, one per line.
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (e *writerExporter) exportSpans(ctx context.Context, spans []spanRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sends the spans to an OTLP/HTTP collector, JSON encoded.
+type otlpExporter struct {
+	url    string
+	client *http.Client
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	Status       *otlpStatus     `json:"status,omitempty"`
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpAttribute {
+	var out []otlpAttribute
+	for k, v := range attrs {
+		a := otlpAttribute{Key: k}
+		switch v := v.(type) {
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			a.Value.IntValue = &s
+		default:
+			s := fmt.Sprint(v)
+			a.Value.StringValue = &s
+		}
+		out = append(out, a)
+	}
+
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (e *otlpExporter) exportSpans(ctx context.Context, spans []spanRecord) error {
+	converted := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		converted[i] = otlpSpan{
+			TraceID:      s.TraceID,
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentID,
+			Name:         s.Name,
+			Kind:         s.Kind,
+			Start:        unixNano(s.Start),
+			End:          unixNano(s.End),
+			Attributes:   otlpAttributes(s.Attributes),
+		}
+		if s.Error != "" {
+			// 2 is STATUS_CODE_ERROR.
+			converted[i].Status = &otlpStatus{Code: 2, Message: s.Error}
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": tracerName},
+				"spans": converted,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the collector answered %s", resp.Status)
+	}
+
+	return nil
+}
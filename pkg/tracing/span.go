@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of spans, as numbered by OTLP.
+const (
+	kindInternal = 1
+	kindServer   = 2
+)
+
+// The context keys of the current span, and of the span of the caller
+// taken from the traceparent header.
+const (
+	spanKey   = "tracing.span"
+	remoteKey = "tracing.remote"
+)
+
+// An attribute of a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// A string attribute.
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// An integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+type traceID [16]byte
+
+type spanID [8]byte
+
+func (t traceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s spanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// The position of a span in its trace, as sent to and received from
+// other services.
+type spanContext struct {
+	traceID traceID
+	spanID  spanID
+	sampled bool
+}
+
+// A timed operation within a trace. Spans which are not sampled are
+// still created, so that the trace context is propagated, but are not
+// exported.
+type Span struct {
+	spanContext
+	parent spanID
+	kind   int
+	start  time.Time
+	tracer *tracer
+
+	mu    sync.Mutex
+	name  string
+	attrs []Attribute
+	err   string
+	end   time.Time
+	ended bool
+}
+
+// The trace id of the span, as 32 hex digits.
+func (s *Span) TraceID() string {
+	return s.traceID.String()
+}
+
+// Whether the span will be exported.
+func (s *Span) IsSampled() bool {
+	return s.sampled
+}
+
+// Rename the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// Add attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// Mark the span as failed, with message describing why.
+func (s *Span) SetError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = message
+}
+
+// End the span, exporting it if it is sampled. Spans are only exported
+// once.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sampled {
+		s.tracer.export(s)
+	}
+}
+
+func spanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+func randomBytes(b []byte) {
+	// The ids only need to be unique, so a failing source leaves them
+	// zero rather than failing the request.
+	rand.Read(b)
+}
+
+func newSpanID() spanID {
+	var id spanID
+	randomBytes(id[:])
+	return id
+}
+
+func newTraceID() traceID {
+	var id traceID
+	randomBytes(id[:])
+	return id
+}
+
+// Whether to sample a trace started here or continued from a caller,
+// independently of the decision of the caller.
+func sample(ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	var b [8]byte
+	randomBytes(b[:])
+
+	return float64(binary.BigEndian.Uint64(b[:])>>11)/(1<<53) < ratio
+}
+
+// The W3C trace context in the traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceparent(value string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || sc.traceID == (traceID{}) {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || sc.spanID == (spanID{}) {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.sampled = flags[0]&1 == 1
+
+	return sc, true
+}
+
+func formatTraceparent(sc spanContext) string {
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+
+	return "00-" + sc.traceID.String() + "-" + sc.spanID.String() + "-" + flags
+}
+
+// The trace context sent by the caller of a request, if any.
+func extract(ctx context.Context, header http.Header) context.Context {
+	sc, ok := parseTraceparent(header.Get("traceparent"))
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteKey, sc)
+}
@@ -0,0 +1,135 @@
+// Package tracing traces requests, from the handlers through the calls
+// made to Tiller and Dataporten. Traces are propagated with the W3C trace
+// context, and exported as OpenTelemetry (OTLP) spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/UNINETT/appstore/pkg/logger"
+)
+
+const tracerName = "github.com/UNINETT/appstore"
+
+// Where spans are exported to.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// The collector spans are sent to by the otlp exporter by default.
+const defaultOTLPEndpoint = "localhost:4318"
+
+// Set up the tracer, exporting spans with exporter. The endpoint of the
+// stdout exporter is a file the spans are appended to, or stdout when
+// empty, and that of the otlp exporter the host:port of an OTLP/HTTP
+// collector, using TLS unless prefixed with http://. Requests are
+// sampled with the given ratio, whatever their caller decided, as the
+// callers are not trusted. The returned function flushes the spans not
+// yet exported.
+func Setup(exporter string, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	var e spanExporter
+	var closer io.Closer
+	switch exporter {
+	case "", ExporterNone:
+		setTracer(&tracer{})
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if endpoint != "" {
+			f, err := os.OpenFile(endpoint, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				return nil, err
+			}
+			w, closer = f, f
+		}
+		e = &writerExporter{w: w}
+	case ExporterOTLP:
+		scheme := "https://"
+		if strings.HasPrefix(endpoint, "http://") {
+			scheme = "http://"
+		}
+		endpoint = strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://")
+		if endpoint == "" {
+			endpoint = defaultOTLPEndpoint
+		}
+		e = &otlpExporter{url: scheme + strings.TrimSuffix(endpoint, "/") + "/v1/traces", client: &http.Client{}}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s or %s", exporter, ExporterNone, ExporterStdout, ExporterOTLP)
+	}
+
+	t := newTracer(e, sampleRatio)
+	setTracer(t)
+
+	return func(ctx context.Context) error {
+		setTracer(&tracer{})
+		err := t.shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+// Start a span, as a child of the span in ctx if there is one.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return currentTracer().start(ctx, name, kindInternal, attrs)
+}
+
+// End span, marking it as failed if err is not nil.
+func End(span *Span, err error) {
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	span.End()
+}
+
+// Add the W3C trace context of ctx to the headers of an outbound request.
+func Inject(ctx context.Context, header http.Header) {
+	if span := spanFromContext(ctx); span != nil {
+		header.Set("traceparent", formatTraceparent(span.spanContext))
+	}
+}
+
+// Create a span for every request, continuing the trace of the caller
+// if it sent a trace context. The trace id is added to the request log.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := extract(r.Context(), r.Header)
+		ctx, span := currentTracer().start(ctx, r.Method, kindServer, []Attribute{
+			String("http.method", r.Method),
+			String("http.target", r.URL.Path),
+			String("http.request_id", middleware.GetReqID(r.Context())),
+		})
+		defer span.End()
+		if span.IsSampled() {
+			logger.AddRequestFields(ctx, logrus.Fields{"trace_id": span.TraceID()})
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(String("http.route", rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(Int("http.status_code", status))
+		if status >= 500 {
+			span.SetError(http.StatusText(status))
+		}
+	})
+}
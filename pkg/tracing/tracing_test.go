@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+const callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []spanRecord
+}
+
+func (r *recorder) exportSpans(ctx context.Context, spans []spanRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+// Trace with ratio, returning the spans exported once fn is done.
+func record(t *testing.T, ratio float64, fn func()) []spanRecord {
+	rec := new(recorder)
+	tr := newTracer(rec, ratio)
+	setTracer(tr)
+	defer setTracer(&tracer{})
+
+	fn()
+	if err := tr.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.spans
+}
+
+func TestMiddleware(t *testing.T) {
+	outbound := make(http.Header)
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/releases/{releaseName}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "child")
+		span.End()
+		Inject(r.Context(), outbound)
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	spans := record(t, 1, func() {
+		req := httptest.NewRequest("GET", "/releases/jupyter-abc123", nil)
+		req.Header.Set("traceparent", "00-"+callerTrace+"-00f067aa0ba902b7-01")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	if tp := outbound.Get("traceparent"); !strings.HasPrefix(tp, "00-"+callerTrace+"-") || !strings.HasSuffix(tp, "-01") {
+		t.Errorf("the trace context was not propagated: %q", tp)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected two spans, got %d", len(spans))
+	}
+	child, server := spans[0], spans[1]
+	if server.Name != "GET /releases/{releaseName}" {
+		t.Errorf("unexpected span name: %s", server.Name)
+	}
+	if server.TraceID != callerTrace || server.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("the span is not part of the trace of the caller: %s %s", server.TraceID, server.ParentID)
+	}
+	if child.TraceID != callerTrace || child.ParentID != server.SpanID {
+		t.Errorf("the child span is not part of the request span: %s %s", child.TraceID, child.ParentID)
+	}
+	if server.Attributes["http.status_code"] != int64(http.StatusNotFound) {
+		t.Errorf("unexpected attributes: %v", server.Attributes)
+	}
+}
+
+func TestSamplerIgnoresCaller(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	spans := record(t, 0, func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("traceparent", "00-"+callerTrace+"-00f067aa0ba902b7-01")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	})
+	if len(spans) != 0 {
+		t.Errorf("the caller decided to sample the request: %d spans", len(spans))
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"00-" + callerTrace + "-00f067aa0ba902b7-01":              true,
+		"01-" + callerTrace + "-00f067aa0ba902b7-00-next":         true,
+		"00-" + callerTrace + "-00f067aa0ba902b7-01-next":         false,
+		"ff-" + callerTrace + "-00f067aa0ba902b7-01":              false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"00-" + callerTrace + "-0000000000000000-01":              false,
+		"00-" + callerTrace + "-00f067aa0ba902b7":                 false,
+		"00-" + callerTrace + "-00f067aa0ba902bz-01":              false,
+	} {
+		if _, ok := parseTraceparent(value); ok != valid {
+			t.Errorf("%s: expected valid %v", value, valid)
+		}
+	}
+}
+
+func TestStdoutExporter(t *testing.T) {
+	f, err := ioutil.TempFile("", "spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	shutdown, err := Setup(ExporterStdout, f.Name(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "LocateChartPath", String("chart.name", "jupyter"))
+	End(span, os.ErrNotExist)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s spanRecord
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("invalid span %q: %s", data, err.Error())
+	}
+	if s.Name != "LocateChartPath" || s.Error != os.ErrNotExist.Error() || s.Attributes["chart.name"] != "jupyter" {
+		t.Errorf("unexpected span: %+v", s)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	shutdown, err := Setup(ExporterOTLP, ts.URL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "tiller.ListReleases")
+	End(span, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, _ := json.Marshal(body)
+	for _, expected := range []string{`"name":"tiller.ListReleases"`, `"stringValue":"appstore"`, `"startTimeUnixNano":"`} {
+		if !strings.Contains(string(encoded), expected) {
+			t.Errorf("%s is missing from %s", expected, encoded)
+		}
+	}
+}